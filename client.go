@@ -3,39 +3,269 @@ package conohav3
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const dnsServiceBaseURL = "https://dns-service.%s.conoha.io"
 
+// modulePath is the import path used to look up this module's version in the build info.
+const modulePath = "github.com/libdns/conoha"
+
+// defaultUserAgent identifies this package to the ConoHa API unless overridden.
+var defaultUserAgent = "libdns-conohav3/" + moduleVersion()
+
+// moduleVersion returns the version of this module as recorded in the build info.
+func moduleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "devel"
+	}
+
+	if info.Main.Path == modulePath && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			return dep.Version
+		}
+	}
+
+	return "devel"
+}
+
+// DefaultRegion is the region used by Providers whose Region is empty.
+// An application may change it once at startup, before any Provider is used.
+var DefaultRegion = "c3j1"
+
+// RegionEndpoints holds the API base URLs of a region. An empty URL stands for the one built
+// from the usual "https://<service>.<region>.conoha.io" template, so a region following it
+// is supported with an empty RegionEndpoints.
+type RegionEndpoints struct {
+	Identity string `json:"identity,omitempty"` // Identity API base URL
+	DNS      string `json:"dns,omitempty"`      // DNS API base URL
+}
+
+// knownRegions lists the regions of ConoHa VPS Ver.3.0.
+var knownRegions = map[string]bool{
+	"c3j1": true,
+}
+
+// resolveRegion returns region, or fallback when empty.
+// It fails for regions that are neither known nor configured in endpoints, such as typos,
+// before any network call is made.
+func resolveRegion(region, fallback string, endpoints map[string]RegionEndpoints) (string, error) {
+	if region == "" {
+		region = fallback
+	}
+
+	if _, ok := endpoints[region]; !ok && !knownRegions[region] {
+		return "", fmt.Errorf("unknown region %q", region)
+	}
+
+	return region, nil
+}
+
+// defaultHTTPTimeout is used when no HTTP timeout is configured.
+const defaultHTTPTimeout = 5 * time.Second
+
+// defaultMaxResponseSize bounds the response bodies read from ConoHa when no limit is configured.
+// It leaves ample room for the largest zones while keeping a faulty endpoint from exhausting memory.
+const defaultMaxResponseSize = 10 << 20
+
+// listPageSize is the number of items requested per page from list endpoints.
+const listPageSize = 100
+
+// maxListPages bounds the pages fetched by one listing, in case the API keeps returning new ones.
+const maxListPages = 1000
+
+// defaultMaxRetries is used when no retry count is configured.
+const defaultMaxRetries = 3
+
+// defaultAuthMaxRetries is used when no retry count is configured for token acquisition.
+const defaultAuthMaxRetries = 2
+
+// clientOptions holds the settings shared by the Identity and DNS clients.
+type clientOptions struct {
+	region           string
+	defaultRegion    string                     // used when region is empty
+	regionEndpoints  map[string]RegionEndpoints // URLs of the regions not following the template
+	identityEndpoint string
+	dnsEndpoint      string
+
+	httpClient     *http.Client
+	timeout        time.Duration
+	readTimeout    time.Duration
+	writeTimeout   time.Duration
+	maxRetries     int
+	authMaxRetries int
+	maxRetryWait   time.Duration
+	retryBaseDelay time.Duration
+	retryMaxDelay  time.Duration
+	retryable      func(resp *http.Response, err error) bool
+	limiter        *RequestLimiter
+	userAgent      string
+	logger         *slog.Logger
+	metrics        Metrics
+
+	maxResponseSize int64
+
+	dialContext        func(ctx context.Context, network, addr string) (net.Conn, error)
+	insecureSkipVerify bool
+}
+
+// serviceURL returns endpoint when it is set, otherwise the URL that regionURL picks from the
+// regionEndpoints entry of the configured region, falling back to the one built from template.
+func (opts clientOptions) serviceURL(endpoint string, regionURL func(RegionEndpoints) string, template string) (*url.URL, error) {
+	if endpoint != "" {
+		return url.Parse(endpoint)
+	}
+
+	region, err := resolveRegion(opts.region, opts.defaultRegion, opts.regionEndpoints)
+	if err != nil {
+		return nil, err
+	}
+
+	if u := regionURL(opts.regionEndpoints[region]); u != "" {
+		return url.Parse(u)
+	}
+	return url.Parse(fmt.Sprintf(template, region))
+}
+
+// newHTTPClient returns the injected HTTP client, or a default one.
+// Timeouts are applied per request through the context, see withAttemptTimeout.
+func newHTTPClient(opts clientOptions) *http.Client {
+	if opts.httpClient != nil {
+		return opts.httpClient
+	}
+
+	if opts.dialContext == nil && !opts.insecureSkipVerify {
+		return &http.Client{}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.dialContext != nil {
+		transport.DialContext = opts.dialContext
+	}
+	if opts.insecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &http.Client{Transport: transport}
+}
+
+// requestTimeout returns the configured per-request timeout or its default.
+func (opts clientOptions) requestTimeout() time.Duration {
+	if opts.timeout == 0 {
+		return defaultHTTPTimeout
+	}
+	return opts.timeout
+}
+
+// responseLimit returns the configured maximum response body size or its default.
+func (opts clientOptions) responseLimit() int64 {
+	if opts.maxResponseSize <= 0 {
+		return defaultMaxResponseSize
+	}
+	return opts.maxResponseSize
+}
+
+// retryPolicy returns the retry policy allowing the configured number of retries, or def if unset.
+// A negative count disables retries.
+func (opts clientOptions) retryPolicy(maxRetries, def int) retryPolicy {
+	if maxRetries == 0 {
+		maxRetries = def
+	} else if maxRetries < 0 {
+		maxRetries = 0
+	}
+
+	maxRetryWait := opts.maxRetryWait
+	if maxRetryWait == 0 {
+		maxRetryWait = defaultMaxRetryWait
+	}
+
+	return retryPolicy{
+		maxRetries:     maxRetries,
+		maxWait:        maxRetryWait,
+		attemptTimeout: opts.requestTimeout(),
+		baseDelay:      opts.retryBaseDelay,
+		maxDelay:       opts.retryMaxDelay,
+		retryable:      opts.retryable,
+		limiter:        opts.limiter,
+	}
+}
+
 // dnsClient is a ConoHa API client for DNS service.
 type dnsClient struct {
-	token string
+	tokenMu sync.Mutex // guards token, which reauthenticate may replace while requests are in flight
+	token   string
+
+	// reauthenticate obtains a new token after ConoHa rejected the current one (optional).
+	// Calls are serialized by refreshMu.
+	reauthenticate func(ctx context.Context) (string, error)
+	refreshMu      sync.Mutex
+
+	retry     retryPolicy
+	userAgent string
+	logger    *slog.Logger
+	metrics   Metrics
+
+	// readTimeout and writeTimeout replace retry.attemptTimeout for GET requests
+	// and for the other requests respectively, when set.
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+
+	maxResponseSize int64
+
+	// planner collects the changes skipped while dryRun is set, instead of them being sent.
+	// dryRun is updated by the Provider on each call, so that DryRun can be toggled.
+	planner *planner
+	dryRun  atomic.Bool
 
 	baseURL    *url.URL
 	HTTPClient *http.Client
 }
 
-// newDnsClient returns a client for DNS service instance logged into the ConoHa service.
-func newDnsClient(region, token string) (*dnsClient, error) {
-	if region == "" {
-		region = "c3j1"
+// plan returns the planner to add skipped changes to in dry-run mode, or nil if changes are to be sent.
+func (c *dnsClient) plan() *planner {
+	if !c.dryRun.Load() {
+		return nil
 	}
+	return c.planner
+}
 
-	baseURL, err := url.Parse(fmt.Sprintf(dnsServiceBaseURL, region))
+// newDnsClient returns a client for DNS service instance logged into the ConoHa service.
+func newDnsClient(opts clientOptions, token string) (*dnsClient, error) {
+	baseURL, err := opts.serviceURL(opts.dnsEndpoint, func(e RegionEndpoints) string { return e.DNS }, dnsServiceBaseURL)
 	if err != nil {
 		return nil, err
 	}
 
 	return &dnsClient{
 		token:      token,
+		retry:      opts.retryPolicy(opts.maxRetries, defaultMaxRetries),
+		userAgent:  opts.userAgent,
+		logger:     opts.logger,
+		metrics:    opts.metrics,
 		baseURL:    baseURL,
-		HTTPClient: &http.Client{Timeout: 5 * time.Second},
+		HTTPClient: newHTTPClient(opts),
+
+		readTimeout:  opts.readTimeout,
+		writeTimeout: opts.writeTimeout,
+
+		maxResponseSize: opts.responseLimit(),
 	}, nil
 }
 
@@ -47,67 +277,189 @@ func (c *dnsClient) getDomainID(ctx context.Context, domainName string) (string,
 	}
 
 	for _, domain := range domainList.Domains {
-		if domain.Name == domainName {
+		if strings.EqualFold(domain.Name, domainName) {
 			return domain.UUID, nil
 		}
 	}
 
-	return "", fmt.Errorf("no such domain: %s", domainName)
+	return "", fmt.Errorf("%w: %s", ErrZoneNotFound, domainName)
 }
 
 // getDomains returns a list of domains registered in DNS.
+// It follows the limit/offset pagination until every domain has been fetched.
 // https://doc.conoha.jp/reference/api-vps3/api-dns-vps3/dnsaas-get_domains_list-v3/?btn_id=reference-api-vps3--sidebar_reference-dnsaas-get_domains_list-v3
 func (c *dnsClient) getDomains(ctx context.Context) (*domainListResponse, error) {
+	domainList := &domainListResponse{}
+	pages := pageTracker{}
+
+	for fetched := 0; ; {
+		endpoint := c.baseURL.JoinPath("v1", "domains")
+		endpoint.RawQuery = pageQuery(fetched).Encode()
+
+		req, err := newJSONRequest(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		page := &domainListResponse{}
+
+		err = c.do(req, page)
+		if err != nil {
+			return nil, err
+		}
+
+		fetched += len(page.Domains)
+		added := 0
+		for _, d := range page.Domains {
+			if pages.isNew(d.UUID) {
+				domainList.Domains = append(domainList.Domains, d)
+				added++
+			}
+		}
+
+		last, err := pages.isLast(len(page.Domains), added, fetched, page.TotalCount)
+		if err != nil {
+			return nil, err
+		}
+		if last {
+			break
+		}
+	}
+
+	domainList.TotalCount = len(domainList.Domains)
+
+	return domainList, nil
+}
+
+// createDomain adds a new domain (zone) and returns it with its UUID.
+// https://doc.conoha.jp/reference/api-vps3/api-dns-vps3/dnsaas-create_domain-v3/
+func (c *dnsClient) createDomain(ctx context.Context, newDomain domain) (*domain, error) {
 	endpoint := c.baseURL.JoinPath("v1", "domains")
 
-	req, err := newJSONRequest(ctx, http.MethodGet, endpoint, nil)
+	req, err := newJSONRequest(ctx, http.MethodPost, endpoint, newDomain)
 	if err != nil {
 		return nil, err
 	}
 
-	domainList := &domainListResponse{}
+	created := &domain{}
 
-	err = c.do(req, domainList)
+	err = c.do(req, created)
 	if err != nil {
 		return nil, err
 	}
 
-	return domainList, nil
+	return created, nil
 }
 
-// getRecordID returns an ID of specified record.
-func (c *dnsClient) getRecordID(ctx context.Context, domainID, recordName, recordType string) (string, error) {
-	recordList, err := c.getRecords(ctx, domainID)
+// updateDomain changes the email and TTL of the domain (zone) identified by domainID.
+// https://doc.conoha.jp/reference/api-vps3/api-dns-vps3/dnsaas-update_domain-v3/
+func (c *dnsClient) updateDomain(ctx context.Context, domainID string, update domainUpdate) (*domain, error) {
+	endpoint := c.baseURL.JoinPath("v1", "domains", domainID)
+
+	req, err := newJSONRequest(ctx, http.MethodPut, endpoint, update)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	for _, record := range recordList.Records {
-		if record.Name == recordName && record.Type == recordType {
-			return record.UUID, nil
-		}
+	updated := &domain{}
+
+	err = c.do(req, updated)
+	if err != nil {
+		return nil, zoneNotFound(err, domainID)
 	}
 
-	return "", errRecordNotFound
+	return updated, nil
 }
 
-// getRecords returns a list of records registered for the domain identified by the domainID.
-// https://doc.conoha.jp/reference/api-vps3/api-dns-vps3/dnsaas-get_records_list-v3/?btn_id=reference-dnsaas-get_domains_list-v3--sidebar_reference-dnsaas-get_records_list-v3
-func (c *dnsClient) getRecords(ctx context.Context, domainID string) (*recordListResponse, error) {
-	endpoint := c.baseURL.JoinPath("v1", "domains", domainID, "records")
+// deleteDomain removes the domain (zone) identified by domainID, along with its records.
+// https://doc.conoha.jp/reference/api-vps3/api-dns-vps3/dnsaas-delete_domain-v3/
+func (c *dnsClient) deleteDomain(ctx context.Context, domainID string) error {
+	endpoint := c.baseURL.JoinPath("v1", "domains", domainID)
 
-	req, err := newJSONRequest(ctx, http.MethodGet, endpoint, nil)
+	req, err := newJSONRequest(ctx, http.MethodDelete, endpoint, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	recordList := &recordListResponse{}
+	err = c.do(req, nil)
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrZoneNotFound, domainID)
+	}
 
-	err = c.do(req, recordList)
+	return err
+}
+
+// getRecord returns the first record matching the specified name, compared case-insensitively,
+// and type, and also the specified data unless recordData is empty.
+func (c *dnsClient) getRecord(ctx context.Context, domainID, recordName, recordType, recordData string) (*conohaDNSRecord, error) {
+	recordList, err := c.getRecords(ctx, domainID, recordType)
 	if err != nil {
 		return nil, err
 	}
 
+	for _, record := range recordList.Records {
+		if strings.EqualFold(record.Name, recordName) && record.Type == recordType && (recordData == "" || record.Data == recordData) {
+			return &record, nil
+		}
+	}
+
+	return nil, errRecordNotFound
+}
+
+// getRecords returns a list of records registered for the domain identified by the domainID.
+// It follows the limit/offset pagination until every record has been fetched.
+// If recordType is not empty, only records of that type are returned: the type is sent as a
+// query parameter so that ConoHa can filter them, and checked again in case it is ignored.
+// https://doc.conoha.jp/reference/api-vps3/api-dns-vps3/dnsaas-get_records_list-v3/?btn_id=reference-dnsaas-get_domains_list-v3--sidebar_reference-dnsaas-get_records_list-v3
+func (c *dnsClient) getRecords(ctx context.Context, domainID, recordType string) (*recordListResponse, error) {
+	recordList := &recordListResponse{}
+	pages := pageTracker{}
+
+	for fetched := 0; ; {
+		endpoint := c.baseURL.JoinPath("v1", "domains", domainID, "records")
+		query := pageQuery(fetched)
+		if recordType != "" {
+			query.Set("type", recordType)
+		}
+		endpoint.RawQuery = query.Encode()
+
+		req, err := newJSONRequest(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		page := &recordListResponse{}
+
+		err = c.do(req, page)
+		if err != nil {
+			return nil, zoneNotFound(err, domainID)
+		}
+
+		fetched += len(page.Records)
+		added := 0
+		for _, record := range page.Records {
+			if !pages.isNew(record.UUID) {
+				continue
+			}
+			added++
+			if recordType == "" || record.Type == recordType {
+				recordList.Records = append(recordList.Records, record)
+			}
+		}
+
+		last, err := pages.isLast(len(page.Records), added, fetched, page.TotalCount)
+		if err != nil {
+			return nil, err
+		}
+		if last {
+			break
+		}
+	}
+
+	recordList.TotalCount = len(recordList.Records)
+
 	return recordList, nil
 }
 
@@ -116,19 +468,40 @@ func (c *dnsClient) getRecords(ctx context.Context, domainID string) (*recordLis
 func (c *dnsClient) createRecord(ctx context.Context, domainID string, record conohaDNSRecord) (*conohaDNSRecord, error) {
 	endpoint := c.baseURL.JoinPath("v1", "domains", domainID, "records")
 
-	req, err := newJSONRequest(ctx, http.MethodPost, endpoint, record)
-	if err != nil {
-		return nil, err
+	if planner := c.plan(); planner != nil {
+		planner.add(ctx, PlannedChange{Action: "create", Record: convertToLibdnsRecordOrRR(record)})
+		return &record, nil
 	}
 
-	newRecord := &conohaDNSRecord{}
+	// A creation failing in a way that doesn't tell whether ConoHa stored the record,
+	// e.g. with HTTP 502 or a timeout, is retried only if the record can't be found.
+	for attempt := 0; ; attempt++ {
+		req, err := newJSONRequest(ctx, http.MethodPost, endpoint, record)
+		if err != nil {
+			return nil, err
+		}
 
-	err = c.do(req, newRecord)
-	if err != nil {
-		return nil, err
-	}
+		newRecord := &conohaDNSRecord{}
+		err = c.do(req, newRecord)
+		if err == nil {
+			return newRecord, nil
+		}
+		if attempt >= c.retry.maxRetries || ctx.Err() != nil || !c.retry.maybeProcessed(err) {
+			return nil, zoneNotFound(err, domainID)
+		}
 
-	return newRecord, nil
+		existing, lookupErr := c.getRecord(ctx, domainID, record.Name, record.Type, record.Data)
+		if lookupErr == nil {
+			return existing, nil
+		}
+		if !errors.Is(lookupErr, errRecordNotFound) {
+			return nil, err
+		}
+
+		if err := sleepWithContext(ctx, c.retry.retryDelay(attempt)); err != nil {
+			return nil, err
+		}
+	}
 }
 
 // updateRecord update specified record.
@@ -148,6 +521,12 @@ func (c *dnsClient) updateRecord(ctx context.Context, domainID string, recordID
 		return nil, err
 	}
 
+	if planner := c.plan(); planner != nil {
+		record.UUID = recordID
+		planner.add(ctx, PlannedChange{Action: "update", RecordID: recordID, Record: convertToLibdnsRecordOrRR(record)})
+		return &record, nil
+	}
+
 	newRecord := &conohaDNSRecord{}
 	err = c.do(req, newRecord)
 	if err != nil {
@@ -158,6 +537,7 @@ func (c *dnsClient) updateRecord(ctx context.Context, domainID string, recordID
 }
 
 // DeleteRecord removes specified record.
+// A record that is already gone (HTTP 404) is treated as deleted so that retries are idempotent.
 // https://doc.conoha.jp/reference/api-vps3/api-dns-vps3/dnsaas-delete_record-v3/?btn_id=reference-dnsaas-create_record-v3--sidebar_reference-dnsaas-delete_record-v3
 func (c *dnsClient) deleteRecord(ctx context.Context, domainID, recordID string) error {
 	endpoint := c.baseURL.JoinPath("v1", "domains", domainID, "records", recordID)
@@ -167,32 +547,71 @@ func (c *dnsClient) deleteRecord(ctx context.Context, domainID, recordID string)
 		return err
 	}
 
-	return c.do(req, nil)
+	if planner := c.plan(); planner != nil {
+		planner.add(ctx, PlannedChange{Action: "delete", RecordID: recordID})
+		return nil
+	}
+
+	err = c.do(req, nil)
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+
+	return err
 }
 
 // do sends an HTTP request and optionally decodes the JSON response into the provided result.
+// Transient failures are retried according to c.retry; POST requests only when they
+// didn't reach the API, so that a record isn't created twice (see createRecord).
 func (c *dnsClient) do(req *http.Request, result any) error {
-	if c.token != "" {
-		req.Header.Set("X-Auth-Token", c.token)
-	}
-
-	resp, err := c.HTTPClient.Do(req)
+	token := c.currentToken()
+	resp, err := c.send(req, token)
 	if err != nil {
 		return err
 	}
 
+	// A token revoked before its expiry, e.g. after a password change, is rejected with HTTP 401.
+	// Authenticate again and retry once, which can't loop since the retry isn't retried.
+	if resp.StatusCode == http.StatusUnauthorized && c.reauthenticate != nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+
+		token, err = c.refreshToken(req.Context(), token)
+		if err != nil {
+			return fmt.Errorf("token rejected by ConoHa, re-authentication failed: %w", err)
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+		resp, err = c.send(req, token)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusUnauthorized {
+			defer func() { _ = resp.Body.Close() }()
+			return fmt.Errorf("token rejected by ConoHa even after re-authentication: %w", newAPIError(resp, token, c.maxResponseSize))
+		}
+	}
+
 	defer func() { _ = resp.Body.Close() }()
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("got error status: HTTP %d\nResponse body: %s", resp.StatusCode, string(bodyBytes))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return newAPIError(resp, token, c.maxResponseSize)
 	}
 
 	if result == nil {
 		return nil
 	}
 
-	raw, err := io.ReadAll(resp.Body)
+	raw, err := readBody(resp.Body, c.maxResponseSize)
 	if err != nil {
 		return err
 	}
@@ -205,6 +624,178 @@ func (c *dnsClient) do(req *http.Request, result any) error {
 	return nil
 }
 
+// send sends req authenticated with token, retrying transient failures.
+func (c *dnsClient) send(req *http.Request, token string) (*http.Response, error) {
+	if token != "" {
+		req.Header.Set("X-Auth-Token", token)
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	policy := c.retry
+	timeout := c.writeTimeout
+	if req.Method == http.MethodGet {
+		timeout = c.readTimeout
+	}
+	if timeout > 0 {
+		policy.attemptTimeout = timeout
+	}
+	if req.Method == http.MethodPost {
+		policy = policy.unsentOnly()
+	}
+
+	start := time.Now()
+	resp, err := doWithRetry(c.HTTPClient, req, policy)
+	logRequest(c.logger, req, resp, start, err)
+	observeRequest(c.metrics, req, resp, start)
+	return resp, err
+}
+
+// currentToken returns the token sent with requests.
+func (c *dnsClient) currentToken() string {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+
+	return c.token
+}
+
+// refreshToken replaces the rejected token with a new one. If another request already
+// replaced it, the new token is returned without authenticating again.
+func (c *dnsClient) refreshToken(ctx context.Context, rejected string) (string, error) {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	if token := c.currentToken(); token != rejected {
+		return token, nil
+	}
+
+	token, err := c.reauthenticate(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	c.tokenMu.Lock()
+	c.token = token
+	c.tokenMu.Unlock()
+	return token, nil
+}
+
+// newAPIError reads the body of the failed resp into an APIError, masking token.
+// At most limit bytes of the body are kept.
+func newAPIError(resp *http.Response, token string, limit int64) *APIError {
+	bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, limit))
+	return &APIError{
+		StatusCode: resp.StatusCode,
+		Body:       redact(string(bodyBytes), token),
+		RequestID:  requestID(resp.Header),
+	}
+}
+
+// readBody reads r entirely, failing instead of reading more than limit bytes.
+func readBody(r io.Reader, limit int64) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("response body exceeds the limit of %d bytes", limit)
+	}
+	return body, nil
+}
+
+// redacted replaces secrets in text returned to callers, such as error messages.
+const redacted = "[REDACTED]"
+
+// redact returns s with every occurrence of the non-empty secrets replaced by a placeholder.
+func redact(s string, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, redacted)
+		}
+	}
+	return s
+}
+
+// logRequest logs the outcome of req at debug level when logger is set.
+// Only the method, URL, status and latency are logged, so headers such as
+// X-Auth-Token and request bodies carrying passwords never reach the logs.
+func logRequest(logger *slog.Logger, req *http.Request, resp *http.Response, start time.Time, err error) {
+	if logger == nil {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("url", req.URL.Redacted()),
+		slog.Duration("latency", time.Since(start)),
+	}
+	if resp != nil {
+		attrs = append(attrs, slog.Int("status", resp.StatusCode))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+
+	logger.LogAttrs(req.Context(), slog.LevelDebug, "conoha api request", attrs...)
+}
+
+// zoneNotFound wraps err with ErrZoneNotFound if it is an HTTP 404 from an endpoint
+// scoped to domainID, which happens when the zone was deleted since its ID was looked up.
+// The APIError remains available through errors.As.
+func zoneNotFound(err error, domainID string) error {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s: %w", ErrZoneNotFound, domainID, err)
+	}
+	return err
+}
+
+// pageQuery returns the query parameters requesting the page starting at offset.
+func pageQuery(offset int) url.Values {
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(listPageSize))
+	query.Set("offset", strconv.Itoa(offset))
+	return query
+}
+
+// pageTracker follows the pages of a listing, so that it ends even when the API ignores
+// the offset and omits the total count, returning the same page over and over.
+type pageTracker struct {
+	seen  map[string]bool
+	pages int
+}
+
+// isNew reports whether the item with the given UUID wasn't on an earlier page, and remembers it.
+// Items without a UUID are always new.
+func (t *pageTracker) isNew(uuid string) bool {
+	if uuid == "" {
+		return true
+	}
+	if t.seen == nil {
+		t.seen = map[string]bool{}
+	}
+	if t.seen[uuid] {
+		return false
+	}
+	t.seen[uuid] = true
+	return true
+}
+
+// isLast reports whether a list endpoint has no more pages, given the size of the last page,
+// how many of its items were new, the number of items fetched so far and the reported total.
+// It fails once maxListPages pages have been fetched without reaching the end.
+func (t *pageTracker) isLast(pageLen, added, fetched, total int) (bool, error) {
+	t.pages++
+	if pageLen < listPageSize || added == 0 || (total > 0 && fetched >= total) {
+		return true, nil
+	}
+	if t.pages >= maxListPages {
+		return false, fmt.Errorf("listing not complete after %d pages", maxListPages)
+	}
+	return false, nil
+}
+
 // newJSONRequest creates a new HTTP request with a JSON-encoded payload.
 func newJSONRequest(ctx context.Context, method string, endpoint *url.URL, payload any) (*http.Request, error) {
 	buf := new(bytes.Buffer)
@@ -222,6 +813,7 @@ func newJSONRequest(ctx context.Context, method string, endpoint *url.URL, paylo
 	}
 
 	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", defaultUserAgent)
 
 	if payload != nil {
 		req.Header.Set("Content-Type", "application/json")
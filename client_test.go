@@ -0,0 +1,673 @@
+package conohav3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestDNSClient(t *testing.T, handler http.HandlerFunc) *dnsClient {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	baseURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &dnsClient{
+		token: "test-token",
+		retry: retryPolicy{
+			maxRetries:     defaultMaxRetries,
+			maxWait:        defaultMaxRetryWait,
+			attemptTimeout: defaultHTTPTimeout,
+		},
+		maxResponseSize: defaultMaxResponseSize,
+		baseURL:         baseURL,
+		HTTPClient:      server.Client(),
+	}
+}
+
+func TestClientOptions_RegionEndpoints(t *testing.T) {
+	regionEndpoints := map[string]RegionEndpoints{"c3j2": {}, "x1": {DNS: "https://dns.x1.example.net"}}
+
+	tests := []struct {
+		region, identity, dns string
+	}{
+		{region: "", identity: "https://identity.c3j1.conoha.io", dns: "https://dns-service.c3j1.conoha.io"},
+		{region: "c3j1", identity: "https://identity.c3j1.conoha.io", dns: "https://dns-service.c3j1.conoha.io"},
+		{region: "c3j2", identity: "https://identity.c3j2.conoha.io", dns: "https://dns-service.c3j2.conoha.io"},
+		{region: "x1", identity: "https://identity.x1.conoha.io", dns: "https://dns.x1.example.net"},
+	}
+	for _, tt := range tests {
+		opts := clientOptions{region: tt.region, defaultRegion: "c3j1", regionEndpoints: regionEndpoints}
+
+		identifier, err := newIdentifier(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, err := newDnsClient(opts, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := identifier.baseURL.String(); got != tt.identity {
+			t.Errorf("region %q: unexpected Identity URL %q, want %q", tt.region, got, tt.identity)
+		}
+		if got := client.baseURL.String(); got != tt.dns {
+			t.Errorf("region %q: unexpected DNS URL %q, want %q", tt.region, got, tt.dns)
+		}
+	}
+}
+
+func TestResolveRegion_DefaultRegion(t *testing.T) {
+	endpoints := map[string]RegionEndpoints{"x1": {}}
+
+	if region, err := resolveRegion("", "x1", endpoints); err != nil || region != "x1" {
+		t.Fatalf("expected the default region, got %q, %v", region, err)
+	}
+	if region, err := resolveRegion("c3j1", "x1", endpoints); err != nil || region != "c3j1" {
+		t.Fatalf("expected the configured region to take precedence, got %q, %v", region, err)
+	}
+	if _, err := resolveRegion("", "x1", nil); err == nil || !strings.Contains(err.Error(), `unknown region "x1"`) {
+		t.Fatalf("expected an unknown region error for an undeclared default, got %v", err)
+	}
+}
+
+func TestDNSClient_RetriesTransientErrors(t *testing.T) {
+	attempts := 0
+	c := newTestDNSClient(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+
+		var record conohaDNSRecord
+		if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+			t.Errorf("attempt %d: failed to decode body: %v", attempts, err)
+		}
+		if record.Name != "test.example.com." {
+			t.Errorf("attempt %d: unexpected record: %+v", attempts, record)
+		}
+
+		if attempts == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(conohaDNSRecord{UUID: "record-id", Name: record.Name, Type: record.Type, Data: record.Data})
+	})
+
+	updated, err := c.updateRecord(context.TODO(), "domain-id", "record-id", conohaDNSRecord{Name: "test.example.com.", Type: "TXT", Data: "value"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attempts != 2 {
+		t.Fatalf("expected 2 attempts, got %d", attempts)
+	}
+	if updated.UUID != "record-id" {
+		t.Fatalf("unexpected record: %+v", updated)
+	}
+}
+
+func TestDNSClient_RetriesCreationIfMissing(t *testing.T) {
+	var requests []string
+	c := newTestDNSClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method)
+		switch {
+		case r.Method == http.MethodGet:
+			_ = json.NewEncoder(w).Encode(recordListResponse{})
+		case len(requests) == 1:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			_ = json.NewEncoder(w).Encode(conohaDNSRecord{UUID: "record-id", Name: "test.example.com.", Type: "TXT", Data: "value"})
+		}
+	})
+	c.retry.baseDelay = time.Millisecond
+
+	created, err := c.createRecord(context.TODO(), "domain-id", conohaDNSRecord{Name: "test.example.com.", Type: "TXT", Data: "value"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.UUID != "record-id" {
+		t.Fatalf("unexpected record: %+v", created)
+	}
+	if want := []string{http.MethodPost, http.MethodGet, http.MethodPost}; !reflect.DeepEqual(requests, want) {
+		t.Fatalf("expected the record to be looked up before the retry, got %v", requests)
+	}
+}
+
+func TestDNSClient_RetriesCreationOnRefusedConnection(t *testing.T) {
+	// Grab a free port and close it, so that connections to it are refused.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	_ = listener.Close()
+
+	c := newTestDNSClient(t, func(w http.ResponseWriter, r *http.Request) {})
+	c.baseURL, _ = url.Parse("http://" + addr)
+	c.retry.baseDelay = time.Millisecond
+	c.retry.maxRetries = 2
+	attempts := 0
+	c.retry.retryable = func(resp *http.Response, err error) bool {
+		attempts++
+		return DefaultRetryPolicy(resp, err)
+	}
+
+	if _, err := c.createRecord(context.TODO(), "domain-id", conohaDNSRecord{Name: "test.example.com.", Type: "TXT", Data: "value"}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if attempts != 2 {
+		t.Fatalf("expected the refused connection to be retried, got %d retry decisions", attempts)
+	}
+}
+
+func TestDNSClient_DoesNotRetryClientErrors(t *testing.T) {
+	attempts := 0
+	c := newTestDNSClient(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+	})
+
+	_, err := c.getDomains(context.TODO())
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected an APIError with HTTP 400, got %v", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("expected 1 attempt, got %d", attempts)
+	}
+}
+
+func TestDNSClient_CustomRetryPolicy(t *testing.T) {
+	statuses := []int{http.StatusConflict, http.StatusServiceUnavailable}
+	attempts := 0
+	c := newTestDNSClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statuses[attempts])
+		attempts++
+	})
+	c.retry.baseDelay = time.Millisecond
+	c.retry.retryable = func(resp *http.Response, err error) bool {
+		return err == nil && resp.StatusCode == http.StatusConflict
+	}
+
+	_, err := c.getDomains(context.TODO())
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected an APIError with HTTP 503, got %v", err)
+	}
+	if attempts != 2 {
+		t.Fatalf("expected 2 attempts, got %d", attempts)
+	}
+}
+
+func TestDNSClient_HonorsRetryAfter(t *testing.T) {
+	attempts := 0
+	c := newTestDNSClient(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte(`{"domains":[]}`))
+	})
+
+	if _, err := c.getDomains(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 {
+		t.Fatalf("expected 2 attempts, got %d", attempts)
+	}
+}
+
+func TestDNSClient_RetryAfterExceedingMaxWait(t *testing.T) {
+	attempts := 0
+	c := newTestDNSClient(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	if _, err := c.getDomains(context.TODO()); err == nil {
+		t.Fatal("expected an error")
+	}
+	if attempts != 1 {
+		t.Fatalf("expected 1 attempt, got %d", attempts)
+	}
+}
+
+func TestDNSClient_RetryDelayExceedingDeadline(t *testing.T) {
+	attempts := 0
+	c := newTestDNSClient(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("Retry-After", "2")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.getDomains(ctx)
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected the last API error, got %v", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("expected 1 attempt, got %d", attempts)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("expected to return promptly, took %v", elapsed)
+	}
+}
+
+func TestDNSClient_GetDomainsPaginates(t *testing.T) {
+	const total = 2*listPageSize + 10
+
+	c := newTestDNSClient(t, func(w http.ResponseWriter, r *http.Request) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+
+		resp := domainListResponse{TotalCount: total}
+		for i := offset; i < offset+limit && i < total; i++ {
+			resp.Domains = append(resp.Domains, domain{UUID: strconv.Itoa(i), Name: "zone" + strconv.Itoa(i) + ".example."})
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+
+	domainList, err := c.getDomains(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(domainList.Domains) != total {
+		t.Fatalf("expected %d domains, got %d", total, len(domainList.Domains))
+	}
+
+	domainID, err := c.getDomainID(context.TODO(), "zone205.example.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if domainID != "205" {
+		t.Fatalf("unexpected domain ID: %q", domainID)
+	}
+}
+
+func TestDNSClient_GetRecordsIgnoredOffset(t *testing.T) {
+	// The server ignores offset and total_count, returning the first full page every time.
+	requests := 0
+	c := newTestDNSClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		resp := recordListResponse{}
+		for i := 0; i < listPageSize; i++ {
+			resp.Records = append(resp.Records, conohaDNSRecord{UUID: strconv.Itoa(i), Name: "host" + strconv.Itoa(i) + ".example.com.", Type: "A", Data: "192.0.2.1"})
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+
+	recordList, err := c.getRecords(context.TODO(), "domain-id", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recordList.Records) != listPageSize {
+		t.Fatalf("expected %d distinct records, got %d", listPageSize, len(recordList.Records))
+	}
+	if requests != 2 {
+		t.Fatalf("expected to stop at the first page without new records, got %d requests", requests)
+	}
+}
+
+func TestDNSClient_GetDomainsMaxPages(t *testing.T) {
+	// The server returns new domains forever.
+	c := newTestDNSClient(t, func(w http.ResponseWriter, r *http.Request) {
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+
+		resp := domainListResponse{}
+		for i := offset; i < offset+listPageSize; i++ {
+			resp.Domains = append(resp.Domains, domain{UUID: strconv.Itoa(i), Name: "zone" + strconv.Itoa(i) + ".example."})
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+
+	if _, err := c.getDomains(context.TODO()); err == nil || !strings.Contains(err.Error(), "pages") {
+		t.Fatalf("expected the listing to stop after %d pages, got %v", maxListPages, err)
+	}
+}
+
+func TestDNSClient_GetRecordsByType(t *testing.T) {
+	const total = listPageSize + 5
+
+	// The server ignores the type filter, so the client has to apply it.
+	c := newTestDNSClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("type"); got != "TXT" {
+			t.Errorf("expected the type query parameter, got %q", got)
+		}
+
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+
+		resp := recordListResponse{TotalCount: total}
+		for i := offset; i < offset+limit && i < total; i++ {
+			rec := conohaDNSRecord{UUID: strconv.Itoa(i), Name: "host" + strconv.Itoa(i) + ".example.com.", Type: "A", Data: "192.0.2.1"}
+			if i%2 == 0 {
+				rec.Type, rec.Data = "TXT", "value"
+			}
+			resp.Records = append(resp.Records, rec)
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+
+	recordList, err := c.getRecords(context.TODO(), "domain-id", "TXT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (total + 1) / 2; len(recordList.Records) != want {
+		t.Fatalf("expected %d records, got %d", want, len(recordList.Records))
+	}
+	for _, rec := range recordList.Records {
+		if rec.Type != "TXT" {
+			t.Fatalf("unexpected record: %+v", rec)
+		}
+	}
+}
+
+func TestDNSClient_RecordTimestamps(t *testing.T) {
+	c := newTestDNSClient(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"total_count":4,"records":[
+			{"uuid":"1","name":"a.example.com.","type":"TXT","data":"a","created_at":"2024-01-02T03:04:05Z","updated_at":"2024-02-03T04:05:06.123456+09:00"},
+			{"uuid":"2","name":"b.example.com.","type":"TXT","data":"b","created_at":"2024-01-02T03:04:05.000000"},
+			{"uuid":"3","name":"c.example.com.","type":"TXT","data":"c","created_at":"yesterday","updated_at":null},
+			{"uuid":"4","name":"d.example.com.","type":"TXT","data":"d"}
+		]}`))
+	})
+
+	recordList, err := c.getRecords(context.TODO(), "domain-id", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	want := []struct{ created, updated time.Time }{
+		{created, time.Date(2024, 2, 2, 19, 5, 6, 123456000, time.UTC)},
+		{created, time.Time{}},
+		{time.Time{}, time.Time{}},
+		{time.Time{}, time.Time{}},
+	}
+	if len(recordList.Records) != len(want) {
+		t.Fatalf("expected %d records, got %d", len(want), len(recordList.Records))
+	}
+	for i, rec := range recordList.Records {
+		if rec.Name == "" || !rec.CreatedAt.Equal(want[i].created) || !rec.UpdatedAt.Equal(want[i].updated) {
+			t.Fatalf("unexpected record %d: %+v", i, rec)
+		}
+
+		libRecord, err := convertToLibdnsRecord(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		meta := recordMetadata(libRecord)
+		if !meta.CreatedAt.Equal(want[i].created) || !meta.UpdatedAt.Equal(want[i].updated) {
+			t.Fatalf("unexpected metadata %d: %+v", i, meta)
+		}
+	}
+
+	// The timestamps are never sent back to ConoHa.
+	payload, err := json.Marshal(recordList.Records[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(payload), "_at") {
+		t.Fatalf("unexpected timestamps in %s", payload)
+	}
+}
+
+func TestDNSClient_UserAgent(t *testing.T) {
+	var got string
+	c := newTestDNSClient(t, func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("User-Agent")
+		_, _ = w.Write([]byte(`{"domains":[]}`))
+	})
+
+	if _, err := c.getDomains(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if got != defaultUserAgent {
+		t.Fatalf("unexpected default User-Agent: %q", got)
+	}
+
+	c.userAgent = "custom-agent/1.0"
+	if _, err := c.getDomains(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if got != "custom-agent/1.0" {
+		t.Fatalf("unexpected custom User-Agent: %q", got)
+	}
+}
+
+func TestDNSClient_DeleteMissingRecord(t *testing.T) {
+	c := newTestDNSClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			t.Errorf("unexpected method: %s", r.Method)
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	if err := c.deleteRecord(context.TODO(), "domain-id", "record-id"); err != nil {
+		t.Fatalf("expected 404 to be treated as deleted, got %v", err)
+	}
+}
+
+func TestDNSClient_ContextDeadlineTakesPrecedence(t *testing.T) {
+	c := newTestDNSClient(t, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		_, _ = w.Write([]byte(`{"domains":[]}`))
+	})
+	c.retry.maxRetries = 0
+	c.retry.attemptTimeout = 50 * time.Millisecond
+
+	if _, err := c.getDomains(context.Background()); err == nil {
+		t.Fatal("expected the attempt timeout to apply without a context deadline")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := c.getDomains(ctx); err != nil {
+		t.Fatalf("expected the context deadline to override the attempt timeout, got %v", err)
+	}
+}
+
+func TestDNSClient_RedactsTokenInErrors(t *testing.T) {
+	c := newTestDNSClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"error": "token ` + r.Header.Get("X-Auth-Token") + ` is not allowed"}`))
+	})
+
+	_, err := c.getRecords(context.TODO(), "domain-id", "")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if strings.Contains(err.Error(), c.token) {
+		t.Fatalf("error leaks the token: %v", err)
+	}
+	if !strings.Contains(err.Error(), redacted) {
+		t.Fatalf("expected the token to be masked, got %v", err)
+	}
+}
+
+func TestDNSClient_ReportsRequestID(t *testing.T) {
+	c := newTestDNSClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-GMO-Request-ID", "req-123")
+		w.WriteHeader(http.StatusBadRequest)
+	})
+
+	_, err := c.getRecords(context.TODO(), "domain-id", "")
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected an APIError, got %v", err)
+	}
+	if apiErr.RequestID != "req-123" {
+		t.Fatalf("unexpected request ID: %q", apiErr.RequestID)
+	}
+	if !strings.Contains(err.Error(), "Request ID: req-123") {
+		t.Fatalf("expected the request ID in the error message, got %v", err)
+	}
+}
+
+func TestDNSClient_ReauthenticatesOnce(t *testing.T) {
+	attempts := 0
+	c := newTestDNSClient(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	reauthentications := 0
+	c.reauthenticate = func(ctx context.Context) (string, error) {
+		reauthentications++
+		return "new-token", nil
+	}
+
+	_, err := c.getDomains(context.TODO())
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected an APIError with HTTP 401, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "even after re-authentication") {
+		t.Fatalf("expected the error to mention re-authentication, got %v", err)
+	}
+	if attempts != 2 || reauthentications != 1 {
+		t.Fatalf("expected 2 attempts and 1 re-authentication, got %d and %d", attempts, reauthentications)
+	}
+}
+
+func TestDNSClient_ResponseSizeLimit(t *testing.T) {
+	c := newTestDNSClient(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"domains":[],"total_count":0}`))
+		_, _ = w.Write([]byte(strings.Repeat(" ", 1024)))
+	})
+	c.maxResponseSize = 512
+
+	_, err := c.getDomains(context.TODO())
+	if err == nil || !strings.Contains(err.Error(), "exceeds the limit of 512 bytes") {
+		t.Fatalf("expected a response size error, got %v", err)
+	}
+
+	c.maxResponseSize = 2048
+	if _, err := c.getDomains(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDNSClient_ReadAndWriteTimeouts(t *testing.T) {
+	c := newTestDNSClient(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(`{"domains":[]}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(conohaDNSRecord{UUID: "record-id"})
+	})
+	c.retry.maxRetries = 0
+	c.readTimeout = 20 * time.Millisecond
+	c.writeTimeout = 5 * time.Second
+
+	if _, err := c.getDomains(context.TODO()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the read timeout to expire, got %v", err)
+	}
+	if _, err := c.createRecord(context.TODO(), "domain-id", conohaDNSRecord{Name: "test.example.com.", Type: "TXT", Data: "value"}); err != nil {
+		t.Fatalf("expected the write to succeed within its timeout, got %v", err)
+	}
+}
+
+func TestDNSClient_ContextCancellation(t *testing.T) {
+	calls := map[string]func(ctx context.Context, c *dnsClient) error{
+		"getDomains": func(ctx context.Context, c *dnsClient) error {
+			_, err := c.getDomains(ctx)
+			return err
+		},
+		"createDomain": func(ctx context.Context, c *dnsClient) error {
+			_, err := c.createDomain(ctx, domain{Name: "example.com.", Email: "admin@example.com"})
+			return err
+		},
+		"deleteDomain": func(ctx context.Context, c *dnsClient) error {
+			return c.deleteDomain(ctx, "domain-id")
+		},
+		"getRecords": func(ctx context.Context, c *dnsClient) error {
+			_, err := c.getRecords(ctx, "domain-id", "")
+			return err
+		},
+		"createRecord": func(ctx context.Context, c *dnsClient) error {
+			_, err := c.createRecord(ctx, "domain-id", conohaDNSRecord{Name: "test.example.com.", Type: "TXT", Data: "value"})
+			return err
+		},
+		"updateRecord": func(ctx context.Context, c *dnsClient) error {
+			_, err := c.updateRecord(ctx, "domain-id", "record-id", conohaDNSRecord{Name: "test.example.com.", Type: "TXT", Data: "value"})
+			return err
+		},
+		"deleteRecord": func(ctx context.Context, c *dnsClient) error {
+			return c.deleteRecord(ctx, "domain-id", "record-id")
+		},
+	}
+
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			c := newTestDNSClient(t, func(w http.ResponseWriter, r *http.Request) {
+				// The disconnect is only noticed once the body has been read.
+				_, _ = io.Copy(io.Discard, r.Body)
+				select {
+				case <-r.Context().Done():
+				case <-time.After(5 * time.Second):
+				}
+			})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(50*time.Millisecond, cancel)
+
+			start := time.Now()
+			err := call(ctx, c)
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("expected a context error, got %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Fatalf("expected to return promptly, took %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_RetryDelayJitter(t *testing.T) {
+	policy := retryPolicy{baseDelay: 100 * time.Millisecond, maxDelay: 300 * time.Millisecond}
+
+	for attempt, max := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond} {
+		seen := map[time.Duration]bool{}
+		for i := 0; i < 50; i++ {
+			delay := policy.retryDelay(attempt)
+			if delay < max/2 || delay > max {
+				t.Fatalf("attempt %d: delay %v outside [%v, %v]", attempt, delay, max/2, max)
+			}
+			seen[delay] = true
+		}
+		if len(seen) < 2 {
+			t.Fatalf("attempt %d: expected randomized delays, got %v", attempt, seen)
+		}
+	}
+}
@@ -1,6 +1,14 @@
 package conohav3
 
-import "errors"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/libdns/libdns"
+)
 
 // identityRequest is the top-level payload sent to the Identity v3.
 type identityRequest struct {
@@ -36,25 +44,71 @@ type scope struct {
 	Project project `json:"project"`
 }
 
-// project identifies the target tenant by UUID.
+// project identifies the target tenant, either by UUID or by name within a domain.
 type project struct {
-	ID string `json:"id"`
+	ID     string         `json:"id,omitempty"`
+	Name   string         `json:"name,omitempty"`
+	Domain *projectDomain `json:"domain,omitempty"`
+}
+
+// projectDomain identifies the domain owning the project, by UUID or by name.
+// It is required for projects scoped by name, and optional otherwise.
+type projectDomain struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// identityResponse is the body returned by `POST /v3/auth/tokens`.
+// Only the fields used by this package are decoded.
+type identityResponse struct {
+	Token tokenDetail `json:"token"`
+}
+
+// tokenDetail holds the metadata of an issued token.
+type tokenDetail struct {
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
-// domainListResponse is returned by `GET /v1/domains` and contains all DNS zones (domains) owned by the project.
+// domainListResponse is returned by `GET /v1/domains` and contains DNS zones (domains) owned by the project.
+// The API returns one page at a time; TotalCount is the number of domains across all pages.
 type domainListResponse struct {
-	Domains []domain `json:"domains"`
+	TotalCount int      `json:"total_count,omitempty"`
+	Domains    []domain `json:"domains"`
 }
 
 // domain represents a single hosted DNS zone.
 type domain struct {
-	UUID string `json:"uuid"`
-	Name string `json:"name"`
+	UUID  string `json:"uuid,omitempty"`
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"` // Administrative contact of the SOA record
+	TTL   int    `json:"ttl,omitempty"`
+}
+
+// domainUpdate is the body of `PUT /v1/domains/{domain_uuid}`; unset fields are left unchanged.
+type domainUpdate struct {
+	Email string `json:"email,omitempty"`
+	TTL   int    `json:"ttl,omitempty"`
+}
+
+// ZoneInfo describes a zone created by CreateZone.
+type ZoneInfo struct {
+	Name string // Name of the zone, e.g. "example.com."
+	UUID string // UUID assigned to the zone by ConoHa, empty in dry-run mode
+}
+
+// ZoneSOA holds the SOA parameters of a zone that ConoHa lets the account change.
+// The serial, refresh, retry and expire values are managed by ConoHa.
+type ZoneSOA struct {
+	Email string        // Administrative contact of the zone, e.g. "hostmaster@example.com"
+	TTL   time.Duration // TTL of the zone, in whole seconds
 }
 
-// recordListResponse is returned by `GET /v1/domains/{domain_uuid}/records` and lists every record in the zone.
+// recordListResponse is returned by `GET /v1/domains/{domain_uuid}/records` and lists records in the zone.
+// The API returns one page at a time; TotalCount is the number of records across all pages.
 type recordListResponse struct {
-	Records []conohaDNSRecord `json:"records"`
+	TotalCount int               `json:"total_count,omitempty"`
+	Records    []conohaDNSRecord `json:"records"`
 }
 
 // conohaDNSRecord represents a DNS record inside a zone.
@@ -68,7 +122,190 @@ type conohaDNSRecord struct {
 	Type string `json:"type"`
 	Data string `json:"data"`
 	TTL  int    `json:"ttl,omitempty"` // TTL is readonly on update — see note above.
+
+	Description string `json:"description,omitempty"` // Free-form comment about the record (optional)
+
+	GSLB
+
+	// Set by ConoHa when present in its responses, and never sent back. See UnmarshalJSON.
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"-"`
+}
+
+// UnmarshalJSON decodes a record, reading its created_at and updated_at timestamps leniently:
+// a timestamp without a time zone is taken as UTC, and one that is missing or can't be parsed
+// is left zero rather than failing the whole response.
+func (r *conohaDNSRecord) UnmarshalJSON(b []byte) error {
+	type plain conohaDNSRecord
+	aux := struct {
+		*plain
+		CreatedAt string `json:"created_at"`
+		UpdatedAt string `json:"updated_at"`
+	}{plain: (*plain)(r)}
+
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+
+	r.CreatedAt = parseAPITime(aux.CreatedAt)
+	r.UpdatedAt = parseAPITime(aux.UpdatedAt)
+	return nil
+}
+
+// apiTimeLayouts are the timestamp formats accepted in API responses, tried in order.
+var apiTimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05.999999999"}
+
+// parseAPITime parses a timestamp from an API response, returning the zero time if it can't.
+func parseAPITime(s string) time.Time {
+	for _, layout := range apiTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// RawRecord is a record exactly as stored by ConoHa, including fields that libdns doesn't model.
+// It is returned by Provider.GetRawRecords.
+type RawRecord = conohaDNSRecord
+
+// GSLB holds the optional GSLB (global server load balancing) routing attributes of a record.
+// Records without GSLB routing leave every field empty.
+type GSLB struct {
+	Region string `json:"gslb_region,omitempty"` // Region the record is served for
+	Weight int    `json:"gslb_weight,omitempty"` // Relative weight among the records sharing a name
+	Check  int    `json:"gslb_check,omitempty"`  // Port health-checked before serving the record
+}
+
+// RecordMetadata is attached to the ProviderData field of records returned by Provider.
+// It carries ConoHa-specific information that libdns does not model.
+type RecordMetadata struct {
+	UUID           string // Server-assigned record ID
+	AlreadyPresent bool   // Set by AppendRecords when an identical record already existed and none was created
+	GSLB           GSLB   // GSLB routing attributes, kept when the record is written back
+	Description    string // Comment stored with the record, kept when the record is written back
+
+	CreatedAt time.Time // When the record was created; zero if ConoHa didn't report it
+	UpdatedAt time.Time // When the record was last updated; zero if ConoHa didn't report it
+}
+
+// recordProviderData returns the ProviderData value for rec, or nil if there is nothing to attach.
+func recordProviderData(rec conohaDNSRecord) any {
+	if rec.UUID == "" && rec.GSLB == (GSLB{}) && rec.Description == "" && rec.CreatedAt.IsZero() && rec.UpdatedAt.IsZero() {
+		return nil
+	}
+	return RecordMetadata{
+		UUID:        rec.UUID,
+		GSLB:        rec.GSLB,
+		Description: rec.Description,
+		CreatedAt:   rec.CreatedAt,
+		UpdatedAt:   rec.UpdatedAt,
+	}
+}
+
+// recordMetadata returns the RecordMetadata carried in the ProviderData of rec, if any.
+func recordMetadata(rec libdns.Record) RecordMetadata {
+	var providerData any
+	switch r := rec.(type) {
+	case libdns.Address:
+		providerData = r.ProviderData
+	case libdns.CAA:
+		providerData = r.ProviderData
+	case libdns.CNAME:
+		providerData = r.ProviderData
+	case libdns.MX:
+		providerData = r.ProviderData
+	case libdns.NS:
+		providerData = r.ProviderData
+	case libdns.SRV:
+		providerData = r.ProviderData
+	case libdns.ServiceBinding:
+		providerData = r.ProviderData
+	case libdns.TXT:
+		providerData = r.ProviderData
+	case SOA:
+		providerData = r.ProviderData
+	case ALIAS:
+		providerData = r.ProviderData
+	case DS:
+		providerData = r.ProviderData
+	case TLSA:
+		providerData = r.ProviderData
+	case SSHFP:
+		providerData = r.ProviderData
+	case NAPTR:
+		providerData = r.ProviderData
+	}
+
+	meta, _ := providerData.(RecordMetadata)
+	return meta
+}
+
+// APIError is returned when the ConoHa DNS API responds with an unexpected HTTP status.
+// Use errors.As to inspect the status code.
+type APIError struct {
+	StatusCode int    // HTTP status code of the response
+	Body       string // Raw response body
+	RequestID  string // Correlation ID of the request, to quote to ConoHa support (may be empty)
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("got error status: HTTP %d\nResponse body: %s", e.StatusCode, e.Body)
+	if e.RequestID != "" {
+		msg += "\nRequest ID: " + e.RequestID
+	}
+	return msg
 }
 
+// RecordConflictError is returned by SetRecords for a record read from ConoHa, as identified
+// by the UUID and UpdatedAt of its RecordMetadata, that was changed or deleted since it was read.
+// Use errors.As to inspect it, then read the record again before retrying.
+type RecordConflictError struct {
+	UUID   string    // ID of the record
+	Read   time.Time // UpdatedAt of the record when it was read
+	Stored time.Time // UpdatedAt of the stored record; zero if it was deleted
+}
+
+func (e *RecordConflictError) Error() string {
+	if e.Stored.IsZero() {
+		return fmt.Sprintf("record %s was deleted since it was read", e.UUID)
+	}
+	return fmt.Sprintf("record %s was updated at %s, after it was read at version %s",
+		e.UUID, e.Stored.Format(time.RFC3339Nano), e.Read.Format(time.RFC3339Nano))
+}
+
+// requestIDHeaders lists the response headers that may carry the request correlation ID, by preference.
+var requestIDHeaders = []string{"X-GMO-Request-ID", "X-Openstack-Request-Id", "X-Request-Id"}
+
+// requestID returns the correlation ID found in header, if any.
+func requestID(header http.Header) string {
+	for _, name := range requestIDHeaders {
+		if id := header.Get(name); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// ErrZoneNotFound is returned when the requested zone doesn't exist in the account.
+var ErrZoneNotFound = errors.New("zone not found")
+
+// ErrInvalidRecord is returned, before any request is made, for records whose data ConoHa would reject.
+var ErrInvalidRecord = errors.New("invalid record")
+
+// ErrCNAMEConflict is returned, before any request is made, for records that would put a CNAME
+// record and records of other types at the same name, which DNS forbids.
+var ErrCNAMEConflict = errors.New("CNAME record conflicts with other records at the same name")
+
+// ErrUnsupportedType is returned for records of a type that this provider can't read or write.
+// GetRecords leaves such records out without reporting them.
+var ErrUnsupportedType = errors.New("record type is not supported")
+
+// ErrRecordParse is returned for records whose data can't be parsed, whether read from ConoHa
+// or passed to a method.
+var ErrRecordParse = errors.New("cannot parse record")
+
+// ErrNilRecord is returned when a nil record is passed to a method.
+var ErrNilRecord = errors.New("record is nil")
+
 var errRecordNotFound = errors.New("Record not found")
-var errRecordNotSupported = errors.New("Record Type is not supported")
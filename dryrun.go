@@ -0,0 +1,64 @@
+package conohav3
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/libdns/libdns"
+)
+
+// PlannedChange is a change that a Provider in DryRun mode would have made.
+type PlannedChange struct {
+	Action   string        // "create", "update" or "delete"
+	Zone     string        // Name of the created or deleted zone; empty for record changes
+	RecordID string        // UUID of the updated or deleted record; empty otherwise
+	Record   libdns.Record // Record as it would be stored; nil for deletions and zone changes
+}
+
+// planner collects the changes skipped by a dnsClient in dry-run mode.
+type planner struct {
+	mu      sync.Mutex
+	changes []PlannedChange
+	logger  *slog.Logger
+}
+
+// add records change and logs it when a logger is set.
+func (p *planner) add(ctx context.Context, change PlannedChange) {
+	p.mu.Lock()
+	p.changes = append(p.changes, change)
+	p.mu.Unlock()
+
+	if p.logger == nil {
+		return
+	}
+
+	attrs := []slog.Attr{slog.String("action", change.Action)}
+	if change.Zone != "" {
+		attrs = append(attrs, slog.String("zone", change.Zone))
+	}
+	if change.Record != nil {
+		rr := change.Record.RR()
+		attrs = append(attrs,
+			slog.String("name", rr.Name),
+			slog.String("type", rr.Type),
+			slog.String("data", rr.Data),
+			slog.Duration("ttl", rr.TTL),
+		)
+	}
+	if change.RecordID != "" {
+		attrs = append(attrs, slog.String("record_id", change.RecordID))
+	}
+
+	p.logger.LogAttrs(ctx, slog.LevelInfo, "conoha dry run: change skipped", attrs...)
+}
+
+// take returns the collected changes and starts a new plan.
+func (p *planner) take() []PlannedChange {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	changes := p.changes
+	p.changes = nil
+	return changes
+}
@@ -0,0 +1,34 @@
+package conohav3
+
+import "os"
+
+// Environment variables read by LoadFromEnv.
+const (
+	EnvAPITenantID   = "CONOHA_API_TENANT_ID"
+	EnvAPITenantName = "CONOHA_API_TENANT_NAME"
+	EnvAPIUserID     = "CONOHA_API_USER_ID"
+	EnvAPIPassword   = "CONOHA_API_PASSWORD"
+	EnvRegion        = "CONOHA_REGION"
+)
+
+// LoadFromEnv sets the credentials and region of p from the CONOHA_* environment variables.
+// Variables that are unset or empty leave the corresponding field unchanged.
+// It returns the result of Validate, so that a missing setting is reported right away.
+func (p *Provider) LoadFromEnv() error {
+	for _, v := range []struct {
+		name  string
+		field *string
+	}{
+		{EnvAPITenantID, &p.APITenantID},
+		{EnvAPITenantName, &p.APITenantName},
+		{EnvAPIUserID, &p.APIUserID},
+		{EnvAPIPassword, &p.APIPassword},
+		{EnvRegion, &p.Region},
+	} {
+		if value := os.Getenv(v.name); value != "" {
+			*v.field = value
+		}
+	}
+
+	return p.Validate()
+}
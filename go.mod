@@ -1,5 +1,5 @@
 module github.com/libdns/conoha
 
-go 1.18
+go 1.21
 
 require github.com/libdns/libdns v1.1.0
@@ -2,8 +2,9 @@ package conohav3
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"time"
@@ -11,31 +12,52 @@ import (
 
 const identityBaseURL = "https://identity.%s.conoha.io"
 
+// authToken is a token issued by the Identity API together with its expiry.
+type authToken struct {
+	value     string
+	expiresAt time.Time
+}
+
+// expiresWithin reports whether the token expires within d from now.
+// A token without a known expiry is always treated as expiring.
+func (t *authToken) expiresWithin(d time.Duration) bool {
+	return t.expiresAt.IsZero() || time.Now().Add(d).After(t.expiresAt)
+}
+
 type identifier struct {
+	userAgent string
+	retry     retryPolicy
+	logger    *slog.Logger
+	metrics   Metrics
+
+	maxResponseSize int64
+
 	baseURL    *url.URL
 	HTTPClient *http.Client
 }
 
 // newIdentifier creates a new Identifier.
-func newIdentifier(region string) (*identifier, error) {
-	if region == "" {
-		region = "c3j1"
-	}
-
-	baseURL, err := url.Parse(fmt.Sprintf(identityBaseURL, region))
+func newIdentifier(opts clientOptions) (*identifier, error) {
+	baseURL, err := opts.serviceURL(opts.identityEndpoint, func(e RegionEndpoints) string { return e.Identity }, identityBaseURL)
 	if err != nil {
 		return nil, err
 	}
 
 	return &identifier{
+		userAgent:  opts.userAgent,
+		retry:      opts.retryPolicy(opts.authMaxRetries, defaultAuthMaxRetries),
+		logger:     opts.logger,
+		metrics:    opts.metrics,
 		baseURL:    baseURL,
-		HTTPClient: &http.Client{Timeout: 5 * time.Second},
+		HTTPClient: newHTTPClient(opts),
+
+		maxResponseSize: opts.responseLimit(),
 	}, nil
 }
 
-// getToken returns a x-subject-token from Identity API.
+// getToken returns a x-subject-token and its expiry from Identity API.
 // https://doc.conoha.jp/reference/api-vps3/api-identity-vps3/identity-post_tokens-v3/?btn_id=reference-api-guideline-v3--sidebar_reference-identity-post_tokens-v3
-func (c *identifier) getToken(ctx context.Context, APITenantID, APIUserID, APIPassword string) (string, error) {
+func (c *identifier) getToken(ctx context.Context, tenant project, APIUserID, APIPassword string) (*authToken, error) {
 	auth := auth{
 		Identity: identity{
 			Methods: []string{"password"},
@@ -47,39 +69,70 @@ func (c *identifier) getToken(ctx context.Context, APITenantID, APIUserID, APIPa
 			},
 		},
 		Scope: scope{
-			Project: project{
-				ID: APITenantID,
-			},
+			Project: tenant,
 		},
 	}
 	endpoint := c.baseURL.JoinPath("v3", "auth", "tokens")
 
 	req, err := newJSONRequest(ctx, http.MethodPost, endpoint, &identityRequest{Auth: auth})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	return c.do(req)
 }
 
-// do sends a request and returns a token from x-subject-token header.
-func (c *identifier) do(req *http.Request) (string, error) {
-	resp, err := c.HTTPClient.Do(req)
+// do sends a request and returns a token from x-subject-token header
+// along with its expiry, see tokenExpiry.
+// Transient failures are retried according to c.retry, independently of DNS API retries.
+func (c *identifier) do(req *http.Request) (*authToken, error) {
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	start := time.Now()
+	resp, err := doWithRetry(c.HTTPClient, req, c.retry)
+	logRequest(c.logger, req, resp, start, err)
+	observeRequest(c.metrics, req, resp, start)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("authentication failed: %w", err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 
 	if resp.StatusCode != http.StatusCreated {
-		return "", fmt.Errorf("got invalid status: HTTP %d", resp.StatusCode)
+		return nil, fmt.Errorf("authentication failed: got invalid status: HTTP %d", resp.StatusCode)
 	}
 
 	token := resp.Header.Get("x-subject-token")
 	if token == "" {
-		return "", fmt.Errorf("x-subject-token header is missing in response")
+		return nil, fmt.Errorf("x-subject-token header is missing in response")
 	}
 
-	_, _ = io.Copy(io.Discard, resp.Body)
+	raw, err := readBody(resp.Body, c.maxResponseSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
 
-	return token, nil
+	identityResp := &identityResponse{}
+	err = json.Unmarshal(raw, identityResp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	return &authToken{
+		value:     token,
+		expiresAt: tokenExpiry(identityResp.Token, start),
+	}, nil
+}
+
+// tokenExpiry returns when a token requested at sent expires, on the local clock.
+// Its lifetime is measured between the issued_at and expires_at times of the server, so that
+// a skewed local clock doesn't make the token be used past its expiry or discarded early.
+// Counting it from sent, before the token was issued, errs on the side of refreshing early.
+// Without issued_at, the server's expires_at is used as is.
+func tokenExpiry(detail tokenDetail, sent time.Time) time.Time {
+	if detail.IssuedAt.IsZero() || detail.ExpiresAt.IsZero() {
+		return detail.ExpiresAt
+	}
+	return sent.Add(detail.ExpiresAt.Sub(detail.IssuedAt))
 }
@@ -0,0 +1,185 @@
+package conohav3
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestIdentifier(t *testing.T, handler http.HandlerFunc) *identifier {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	baseURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &identifier{
+		maxResponseSize: defaultMaxResponseSize,
+		baseURL:         baseURL,
+		HTTPClient:      server.Client(),
+	}
+}
+
+func TestIdentifier_GetToken(t *testing.T) {
+	c := newTestIdentifier(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v3/auth/tokens" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		w.Header().Set("X-Subject-Token", "test-token")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"token":{"expires_at":"2025-01-02T03:04:05.000000Z"}}`))
+	})
+
+	token, err := c.getToken(context.TODO(), project{ID: "tenant"}, "user", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.value != "test-token" {
+		t.Fatalf("unexpected token: %q", token.value)
+	}
+
+	want := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	if !token.expiresAt.Equal(want) {
+		t.Fatalf("unexpected expiry: got %v, want %v", token.expiresAt, want)
+	}
+}
+
+func TestIdentifier_GetTokenWithClockSkew(t *testing.T) {
+	// The server's clock is a year behind; the token is valid for 24 hours.
+	c := newTestIdentifier(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Subject-Token", "test-token")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"token":{"issued_at":"2025-01-01T03:04:05.000000Z","expires_at":"2025-01-02T03:04:05.000000Z"}}`))
+	})
+
+	before := time.Now()
+	token, err := c.getToken(context.TODO(), project{ID: "tenant"}, "user", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.expiresAt.Before(before.Add(24*time.Hour)) || token.expiresAt.After(time.Now().Add(24*time.Hour)) {
+		t.Fatalf("expected the expiry to be 24 hours from now, got %v", token.expiresAt)
+	}
+	if token.expiresWithin(tokenRefreshMargin) {
+		t.Fatal("expected a fresh token")
+	}
+}
+
+func TestIdentifier_RetriesTransientErrors(t *testing.T) {
+	attempts := 0
+	c := newTestIdentifier(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("X-Subject-Token", "test-token")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"token":{"expires_at":"2025-01-02T03:04:05.000000Z"}}`))
+	})
+	c.retry = retryPolicy{maxRetries: 1, maxWait: defaultMaxRetryWait}
+
+	token, err := c.getToken(context.TODO(), project{ID: "tenant"}, "user", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.value != "test-token" || attempts != 2 {
+		t.Fatalf("unexpected result after %d attempts: %+v", attempts, token)
+	}
+}
+
+func TestIdentifier_ReportsAuthFailure(t *testing.T) {
+	attempts := 0
+	c := newTestIdentifier(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	c.retry = retryPolicy{maxRetries: 1, maxWait: defaultMaxRetryWait}
+
+	_, err := c.getToken(context.TODO(), project{ID: "tenant"}, "user", "password")
+	if err == nil || !strings.Contains(err.Error(), "authentication failed") {
+		t.Fatalf("expected an authentication error, got %v", err)
+	}
+	if attempts != 2 {
+		t.Fatalf("expected 2 attempts, got %d", attempts)
+	}
+}
+
+func TestIdentifier_GetTokenScopedByName(t *testing.T) {
+	p := &Provider{APITenantName: "tenant-name", APIUserID: "user", APIPassword: "password"}
+
+	c := newTestIdentifier(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Auth struct {
+				Scope struct {
+					Project map[string]any `json:"project"`
+				} `json:"scope"`
+			} `json:"auth"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode body: %v", err)
+		}
+
+		want := map[string]any{"name": "tenant-name", "domain": map[string]any{"id": "default"}}
+		if got := body.Auth.Scope.Project; !reflect.DeepEqual(got, want) {
+			t.Errorf("unexpected project scope: got %v, want %v", got, want)
+		}
+
+		w.Header().Set("X-Subject-Token", "test-token")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"token":{"expires_at":"2025-01-02T03:04:05.000000Z"}}`))
+	})
+
+	if _, err := c.getToken(context.TODO(), p.tenant(), p.APIUserID, p.APIPassword); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProvider_TenantScope(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider *Provider
+		want     project
+	}{
+		{
+			name:     "by ID",
+			provider: &Provider{APITenantID: "tenant-id"},
+			want:     project{ID: "tenant-id"},
+		},
+		{
+			name:     "by ID within a domain",
+			provider: &Provider{APITenantID: "tenant-id", APITenantDomainName: "domain-name"},
+			want:     project{ID: "tenant-id", Domain: &projectDomain{Name: "domain-name"}},
+		},
+		{
+			name:     "by name in the default domain",
+			provider: &Provider{APITenantName: "tenant-name"},
+			want:     project{Name: "tenant-name", Domain: &projectDomain{ID: "default"}},
+		},
+		{
+			name:     "by name within a domain",
+			provider: &Provider{APITenantName: "tenant-name", APITenantDomainID: "domain-id"},
+			want:     project{Name: "tenant-name", Domain: &projectDomain{ID: "domain-id"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.provider.tenant(); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("unexpected scope: got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
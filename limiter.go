@@ -0,0 +1,40 @@
+package conohav3
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// RequestLimiter bounds the number of API requests in flight at once. Share one between
+// several Providers, through their RequestLimiter field, to cap the requests they send
+// together, e.g. to stay within the rate limits of a ConoHa account.
+// A RequestLimiter is safe for concurrent use.
+type RequestLimiter struct {
+	slots chan struct{}
+}
+
+// NewRequestLimiter returns a RequestLimiter allowing up to n requests in flight.
+// It panics if n is not positive.
+func NewRequestLimiter(n int) *RequestLimiter {
+	if n <= 0 {
+		panic(fmt.Sprintf("conohav3: request limit must be positive, got %d", n))
+	}
+	return &RequestLimiter{slots: make(chan struct{}, n)}
+}
+
+// acquire waits for a free slot and returns the function releasing it, which may be called
+// more than once, or the context error if ctx is done first. A nil RequestLimiter doesn't limit requests.
+func (l *RequestLimiter) acquire(ctx context.Context) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		var once sync.Once
+		return func() { once.Do(func() { <-l.slots }) }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,44 @@
+package conohav3
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Metrics receives an event for each API request, e.g. to count requests and
+// record their latency in Prometheus. Implementations must be safe for concurrent use.
+type Metrics interface {
+	// OnRequest is called once per request, after its retries. The endpoint is the URL path
+	// with the zone and record UUIDs replaced by placeholders, such as
+	// "/v1/domains/{domain_id}/records". The status is 0 if no response was received.
+	OnRequest(method, endpoint string, status int, dur time.Duration)
+}
+
+// observeRequest reports the outcome of req to metrics when it is set.
+func observeRequest(metrics Metrics, req *http.Request, resp *http.Response, start time.Time) {
+	if metrics == nil {
+		return
+	}
+
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	metrics.OnRequest(req.Method, endpointTemplate(req.URL.Path), status, time.Since(start))
+}
+
+// endpointTemplate replaces the UUIDs in path with placeholders, to keep the number of
+// distinct endpoints reported to Metrics bounded.
+func endpointTemplate(path string) string {
+	segments := strings.Split(path, "/")
+	for i := 1; i < len(segments); i++ {
+		switch segments[i-1] {
+		case "domains":
+			segments[i] = "{domain_id}"
+		case "records":
+			segments[i] = "{record_id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -2,9 +2,19 @@ package conohav3
 
 import (
 	"context"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/mail"
 	"net/netip"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,170 +29,1639 @@ type Provider struct {
 	APIPassword string `json:"api_password,omitempty"`  // ConoHa API password
 	Region      string `json:"region,omitempty"`        // ConoHa API region (e.g. "c3j1")
 
+	APITenantName     string `json:"api_tenant_name,omitempty"`      // ConoHa API tenant name, used when APITenantID is empty
+	APITenantDomainID string `json:"api_tenant_domain_id,omitempty"` // Domain of the tenant (default: "default" when scoped by APITenantName)
+
+	APITenantDomainName string `json:"api_tenant_domain_name,omitempty"` // Domain of the tenant, by name instead of APITenantDomainID
+
+	IdentityEndpoint string `json:"identity_endpoint,omitempty"` // Overrides the Identity API base URL (optional)
+	DNSEndpoint      string `json:"dns_endpoint,omitempty"`      // Overrides the DNS API base URL (optional)
+
+	// RegionEndpoints declares regions other than the known ones, keyed by region, and sets
+	// their API base URLs; empty URLs follow the "https://<service>.<region>.conoha.io"
+	// template (optional). IdentityEndpoint and DNSEndpoint take precedence over it.
+	RegionEndpoints map[string]RegionEndpoints `json:"region_endpoints,omitempty"`
+
+	HTTPClient *http.Client `json:"-"` // Custom HTTP client used for all API requests (optional)
+
+	// DialContext replaces the dialer of the default HTTP client, e.g. to force IPv6 with a
+	// net.Dialer dialing "tcp6", or to pin addresses (optional). Ignored when HTTPClient is set.
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error) `json:"-"`
+
+	HTTPTimeout  time.Duration `json:"http_timeout,omitempty"`  // Timeout for each API request when ctx has no deadline (default: 5s)
+	ReadTimeout  time.Duration `json:"read_timeout,omitempty"`  // Overrides HTTPTimeout for requests listing zones and records (optional)
+	WriteTimeout time.Duration `json:"write_timeout,omitempty"` // Overrides HTTPTimeout for requests changing zones and records (optional)
+
+	MaxRetries int `json:"max_retries,omitempty"` // Retries for transient DNS API failures (default: 3, negative disables)
+
+	AuthMaxRetries int `json:"auth_max_retries,omitempty"` // Retries for transient Identity API failures (default: 2, negative disables)
+
+	MaxRetryWait time.Duration `json:"max_retry_wait,omitempty"` // Upper bound of the total wait between retries of one request (default: 30s)
+
+	RetryBaseDelay time.Duration `json:"retry_base_delay,omitempty"` // Backoff before the first retry, doubled on each retry (default: 500ms)
+	RetryMaxDelay  time.Duration `json:"retry_max_delay,omitempty"`  // Cap of the backoff between two attempts (default: 5s)
+
+	// RetryPolicy decides whether a failed request to the Identity or DNS API is retried, within
+	// MaxRetries or AuthMaxRetries. resp is nil when err is set (default: DefaultRetryPolicy).
+	// A record creation failing in a way that doesn't show whether it was processed, such as
+	// HTTP 502, is retried only if the record isn't found; zone creations aren't retried then.
+	RetryPolicy func(resp *http.Response, err error) bool `json:"-"`
+
+	UserAgent string `json:"user_agent,omitempty"` // User-Agent header sent with every request (default: "libdns-conohav3/<version>")
+
+	// PreserveTTLOnUpdate makes SetRecords apply TTL changes by recreating the record,
+	// since ConoHa rejects `ttl` on update. Disabled by default: updates keep the stored TTL.
+	PreserveTTLOnUpdate bool `json:"preserve_ttl_on_update,omitempty"`
+
+	ZoneCacheTTL time.Duration `json:"zone_cache_ttl,omitempty"` // How long zone IDs are cached (default: 5m, negative disables)
+
+	DefaultTTL time.Duration `json:"default_ttl,omitempty"` // TTL used for records written with a zero TTL (default: ConoHa's own default)
+
+	// MinTTLPatterns raises to ConoHa's minimum TTL, instead of applying DefaultTTL, the zero or lower TTL
+	// of records whose first label matches one of these path.Match patterns, e.g. "_acme-challenge" (optional).
+	MinTTLPatterns []string `json:"min_ttl_patterns,omitempty"`
+
+	Concurrency int `json:"concurrency,omitempty"` // Records created in parallel by AppendRecords (default: 1, at most 8)
+
+	// RequestLimiter caps the API requests in flight, across all the Providers sharing it (optional).
+	RequestLimiter *RequestLimiter `json:"-"`
+
+	Logger *slog.Logger `json:"-"` // Receives a debug log entry for each API request (optional)
+
+	Metrics Metrics `json:"-"` // Receives the method, endpoint, status and latency of each API request (optional)
+
+	// DryRun makes every method skip the changes it would make to zones and records, while still
+	// reading the current state. Skipped changes are logged through Logger and returned by DryRunPlan.
+	// Methods return the records as they would be after the changes. It may be changed between calls.
+	DryRun bool `json:"dry_run,omitempty"`
+
+	// InsecureSkipVerify disables TLS certificate verification, e.g. against a self-signed mock endpoint.
+	// For testing only: never enable it against the real ConoHa API. Ignored when HTTPClient is set.
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
+
+	DefaultZone string `json:"default_zone,omitempty"` // Zone used by the record methods when their zone argument is empty (optional)
+
+	MaxResponseSize int64 `json:"max_response_size,omitempty"` // Largest API response body read, in bytes (default: 10 MiB)
+
+	DefaultZoneEmail string `json:"default_zone_email,omitempty"` // Contact used by CreateZone when called without an email (optional)
+
+	// mutex guards the state below, which is shared by all zones. It is held only briefly,
+	// or while authenticating, so that operations on different zones run concurrently.
 	mutex sync.Mutex
+
+	// zoneLocks serializes the operations on each zone, keyed by lowercased zone name; guarded by mutex.
+	zoneLocks map[string]*sync.Mutex
+
+	// token caches the last issued token; guarded by mutex.
+	token *authToken
+
+	// identifier and client are built on first use and reused afterwards, as long as
+	// the account they were built for (clientKey) doesn't change; guarded by mutex.
+	identifier *identifier
+	client     *dnsClient
+	clientKey  accountKey
+
+	// domainIDs caches the UUID of each zone by name; guarded by mutex.
+	domainIDs map[string]cachedDomainID
+}
+
+// String describes the provider configuration with APIPassword masked,
+// so that a Provider can be logged or printed without leaking credentials.
+func (p *Provider) String() string {
+	return "conohav3.Provider" + p.fields()
+}
+
+// GoString is like String and is used for the %#v verb.
+func (p *Provider) GoString() string {
+	return "&conohav3.Provider" + p.fields()
+}
+
+// fields formats the identifying configuration fields of p.
+func (p *Provider) fields() string {
+	return fmt.Sprintf("{APITenantID:%q, APIUserID:%q, APIPassword:%q, Region:%q}",
+		p.APITenantID, p.APIUserID, redact(p.APIPassword, p.APIPassword), p.Region)
+}
+
+// DryRunPlan returns the changes skipped in DryRun mode since the previous call, in order.
+func (p *Provider) DryRunPlan() []PlannedChange {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.client == nil || p.client.planner == nil {
+		return nil
+	}
+	return p.client.planner.take()
+}
+
+// Validate checks the provider configuration without making any request,
+// so that misconfiguration can be reported at startup. All problems found are returned as a joined error.
+// It is also called before the first request.
+func (p *Provider) Validate() error {
+	var errs []error
+	if p.APITenantID == "" && p.APITenantName == "" {
+		errs = append(errs, errors.New("APITenantID or APITenantName is required"))
+	}
+	for _, field := range []struct{ name, value string }{
+		{"APIUserID", p.APIUserID},
+		{"APIPassword", p.APIPassword},
+	} {
+		if field.value == "" {
+			errs = append(errs, fmt.Errorf("%s is required", field.name))
+		}
+	}
+
+	if p.DefaultZoneEmail != "" {
+		if err := validateEmail(p.DefaultZoneEmail); err != nil {
+			errs = append(errs, fmt.Errorf("DefaultZoneEmail: %w", err))
+		}
+	}
+
+	if p.DefaultTTL != 0 && (p.DefaultTTL < minTTL*time.Second || p.DefaultTTL > maxTTL*time.Second) {
+		errs = append(errs, fmt.Errorf("DefaultTTL %v is outside ConoHa's range of %ds to %ds", p.DefaultTTL, minTTL, maxTTL))
+	}
+	for _, pattern := range p.MinTTLPatterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("MinTTLPatterns: %q: %w", pattern, err))
+		}
+	}
+
+	// The region is only used to build the endpoints that are not overridden.
+	if p.IdentityEndpoint == "" || p.DNSEndpoint == "" {
+		if _, err := resolveRegion(p.Region, DefaultRegion, p.RegionEndpoints); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, field := range []struct{ name, value string }{
+		{"IdentityEndpoint", p.IdentityEndpoint},
+		{"DNSEndpoint", p.DNSEndpoint},
+	} {
+		if field.value == "" {
+			continue
+		}
+		if u, err := url.Parse(field.value); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("%s %q is not an absolute URL", field.name, field.value))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// tokenRefreshMargin is how long before expiry a cached token is considered stale.
+const tokenRefreshMargin = 5 * time.Minute
+
+// maxConcurrency caps Concurrency to stay within ConoHa's rate limits.
+const maxConcurrency = 8
+
+// defaultZoneCacheTTL is used when no zone cache TTL is configured.
+const defaultZoneCacheTTL = 5 * time.Minute
+
+// cachedDomainID is a zone UUID remembered by getDomainID.
+type cachedDomainID struct {
+	id        string
+	expiresAt time.Time
+}
+
+// clientOptions returns the client settings derived from the provider configuration.
+func (p *Provider) clientOptions() clientOptions {
+	return clientOptions{
+		region:           p.Region,
+		defaultRegion:    DefaultRegion,
+		regionEndpoints:  p.RegionEndpoints,
+		identityEndpoint: p.IdentityEndpoint,
+		dnsEndpoint:      p.DNSEndpoint,
+		httpClient:       p.HTTPClient,
+		timeout:          p.HTTPTimeout,
+		readTimeout:      p.ReadTimeout,
+		writeTimeout:     p.WriteTimeout,
+		maxRetries:       p.MaxRetries,
+		authMaxRetries:   p.AuthMaxRetries,
+		maxRetryWait:     p.MaxRetryWait,
+		retryBaseDelay:   p.RetryBaseDelay,
+		retryMaxDelay:    p.RetryMaxDelay,
+		retryable:        p.RetryPolicy,
+		limiter:          p.RequestLimiter,
+		userAgent:        p.UserAgent,
+		logger:           p.Logger,
+		metrics:          p.Metrics,
+		maxResponseSize:  p.MaxResponseSize,
+
+		dialContext:        p.DialContext,
+		insecureSkipVerify: p.InsecureSkipVerify,
+	}
+}
+
+// defaultTenantDomainID is the Keystone domain of tenants scoped by name when none is configured.
+const defaultTenantDomainID = "default"
+
+// tenant returns the project the token is scoped to: by APITenantID when set,
+// otherwise by APITenantName. The project's domain is sent when configured, as some
+// Keystone setups require it, and defaults to "default" for projects scoped by name.
+func (p *Provider) tenant() project {
+	var domain *projectDomain
+	if p.APITenantDomainID != "" || p.APITenantDomainName != "" {
+		domain = &projectDomain{ID: p.APITenantDomainID, Name: p.APITenantDomainName}
+	}
+
+	if p.APITenantID != "" {
+		return project{ID: p.APITenantID, Domain: domain}
+	}
+
+	if domain == nil {
+		domain = &projectDomain{ID: defaultTenantDomainID}
+	}
+	return project{Name: p.APITenantName, Domain: domain}
+}
+
+// accountKey identifies the account and region a token and zone IDs are valid for.
+type accountKey struct {
+	tenantID, tenantName             string
+	tenantDomainID, tenantDomainName string
+	userID                           string
+	region                           string
+}
+
+// accountKey returns the accountKey of the current configuration.
+func (p *Provider) accountKey() accountKey {
+	return accountKey{
+		tenantID:         p.APITenantID,
+		tenantName:       p.APITenantName,
+		tenantDomainID:   p.APITenantDomainID,
+		tenantDomainName: p.APITenantDomainName,
+		userID:           p.APIUserID,
+		region:           p.Region,
+	}
+}
+
+// initClient returns the DNS API client with a valid authentication token.
+// The clients are built once, sharing one HTTP client, and rebuilt only when the tenant,
+// user or region changes, which also drops the cached token and zone IDs.
+// A cached token is reused until it is close to expiry.
+func (p *Provider) initClient(ctx context.Context) (*dnsClient, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if key := p.accountKey(); p.client == nil || p.clientKey != key {
+		p.client, p.token, p.domainIDs = nil, nil, nil
+
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+
+		opts := p.clientOptions()
+		opts.httpClient = newHTTPClient(opts)
+
+		identifier, err := newIdentifier(opts)
+		if err != nil {
+			return nil, err
+		}
+		client, err := newDnsClient(opts, "")
+		if err != nil {
+			return nil, err
+		}
+		client.planner = &planner{logger: p.Logger}
+		client.reauthenticate = func(ctx context.Context) (string, error) {
+			p.mutex.Lock()
+			defer p.mutex.Unlock()
+
+			token, err := identifier.getToken(ctx, p.tenant(), p.APIUserID, p.APIPassword)
+			if err != nil {
+				return "", err
+			}
+			if p.client == client {
+				p.token = token
+			}
+			return token.value, nil
+		}
+
+		p.identifier, p.client, p.clientKey = identifier, client, key
+	}
+
+	// DryRun is read on every call, so that it can be turned on and off between calls.
+	p.client.dryRun.Store(p.DryRun)
+
+	if p.token == nil || p.token.expiresWithin(tokenRefreshMargin) {
+		token, err := p.identifier.getToken(ctx, p.tenant(), p.APIUserID, p.APIPassword)
+		if err != nil {
+			return nil, err
+		}
+
+		p.token = token
+		p.client.tokenMu.Lock()
+		p.client.token = token.value
+		p.client.tokenMu.Unlock()
+	}
+
+	return p.client, nil
+}
+
+// lockZone serializes the operations on zone, so that read-modify-write sequences such as
+// SetRecords don't interleave, and returns the function releasing the lock.
+func (p *Provider) lockZone(zone string) (unlock func()) {
+	key := zoneKey(zone)
+
+	p.mutex.Lock()
+	if p.zoneLocks == nil {
+		p.zoneLocks = map[string]*sync.Mutex{}
+	}
+	lock, ok := p.zoneLocks[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		p.zoneLocks[key] = lock
+	}
+	p.mutex.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// zoneKey returns the key under which zone is locked and its UUID cached, so that
+// spellings differing only by case share them, as DNS names are case-insensitive.
+func zoneKey(zone string) string {
+	return strings.ToLower(zone)
+}
+
+// zoneOrDefault returns zone, or DefaultZone if zone is empty.
+func (p *Provider) zoneOrDefault(zone string) string {
+	if zone == "" {
+		return p.DefaultZone
+	}
+	return zone
+}
+
+// getDomainID returns the UUID of zone, looking it up only when it isn't cached.
+func (p *Provider) getDomainID(ctx context.Context, dnsClient *dnsClient, zone string) (string, error) {
+	if zone == "" {
+		return "", errors.New("no zone given and DefaultZone is not set")
+	}
+
+	p.mutex.Lock()
+	cached, ok := p.domainIDs[zoneKey(zone)]
+	p.mutex.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.id, nil
+	}
+
+	domainID, err := dnsClient.getDomainID(ctx, zone)
+	if err != nil {
+		return "", err
+	}
+
+	p.cacheDomainID(zone, domainID)
+
+	return domainID, nil
+}
+
+// cacheDomainID remembers the UUID of zone unless caching is disabled.
+func (p *Provider) cacheDomainID(zone, domainID string) {
+	ttl := p.ZoneCacheTTL
+	if ttl == 0 {
+		ttl = defaultZoneCacheTTL
+	}
+	if ttl < 0 {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.domainIDs == nil {
+		p.domainIDs = map[string]cachedDomainID{}
+	}
+	p.domainIDs[zoneKey(zone)] = cachedDomainID{id: domainID, expiresAt: time.Now().Add(ttl)}
+}
+
+// forgetDomainIDOnNotFound drops the cached UUID of zone when err reports an HTTP 404,
+// so that a deleted and recreated zone is looked up again.
+func (p *Provider) forgetDomainIDOnNotFound(zone string, err error) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		p.forgetDomainID(zone)
+	}
+}
+
+// forgetDomainID drops the cached UUID of zone.
+func (p *Provider) forgetDomainID(zone string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	delete(p.domainIDs, zoneKey(zone))
+}
+
+// GetRecords lists all the DNS records in the specified zone.
+// Records that can't be parsed are left out and reported as a joined error,
+// along with all the records that could be parsed.
+func (p *Provider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	return p.GetRecordsByType(ctx, zone, "")
+}
+
+// GetRecordsByType lists the DNS records of type rtype (e.g. "TXT", case-insensitively) in the
+// specified zone, or all of them if rtype is empty. ConoHa is asked to filter them, which avoids
+// fetching every record of a large zone.
+func (p *Provider) GetRecordsByType(ctx context.Context, zone, rtype string) ([]libdns.Record, error) {
+	rtype = strings.ToUpper(rtype)
+	zone = p.zoneOrDefault(zone)
+	defer p.lockZone(zone)()
+
+	dnsClient, err := p.initClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	domainID, err := p.getDomainID(ctx, dnsClient, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	rawRecordList, err := dnsClient.getRecords(ctx, domainID, rtype)
+	if err != nil {
+		p.forgetDomainIDOnNotFound(zone, err)
+		return nil, err
+	}
+
+	// A malformed record doesn't hide the others: its error is returned along with them.
+	var libRecords []libdns.Record
+	var errs []error
+	for _, record := range rawRecordList.Records {
+		libRecord, err := convertToLibdnsRecord(record)
+		if err != nil {
+			if !errors.Is(err, ErrUnsupportedType) {
+				errs = append(errs, recordError(libdns.RR{Name: record.Name, Type: record.Type}, err))
+			}
+			continue
+		}
+		libRecords = append(libRecords, libRecord)
+	}
+
+	return libRecords, errors.Join(errs...)
+}
+
+// GetRawRecords lists all the DNS records in the specified zone as stored by ConoHa,
+// without mapping them to libdns types. Records of every type are included.
+func (p *Provider) GetRawRecords(ctx context.Context, zone string) ([]RawRecord, error) {
+	zone = p.zoneOrDefault(zone)
+	defer p.lockZone(zone)()
+
+	dnsClient, err := p.initClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	domainID, err := p.getDomainID(ctx, dnsClient, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	rawRecordList, err := dnsClient.getRecords(ctx, domainID, "")
+	if err != nil {
+		p.forgetDomainIDOnNotFound(zone, err)
+		return nil, err
+	}
+
+	return rawRecordList.Records, nil
+}
+
+// GetRecord returns the first record in the zone with the given name and type, both compared
+// case-insensitively, and whether one was found. Records of types libdns doesn't model are
+// returned as libdns.RR.
+func (p *Provider) GetRecord(ctx context.Context, zone, name, rtype string) (libdns.Record, bool, error) {
+	rtype = strings.ToUpper(rtype)
+	zone = p.zoneOrDefault(zone)
+	defer p.lockZone(zone)()
+
+	dnsClient, err := p.initClient(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	domainID, err := p.getDomainID(ctx, dnsClient, zone)
+	if err != nil {
+		return nil, false, err
+	}
+
+	record, err := dnsClient.getRecord(ctx, domainID, name, rtype, "")
+	if errors.Is(err, errRecordNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		p.forgetDomainIDOnNotFound(zone, err)
+		return nil, false, err
+	}
+
+	return convertToLibdnsRecordOrRR(*record), true, nil
+}
+
+// GetZoneSerial returns the serial number of the zone's SOA record, which ConoHa increments
+// on every change. Watching it is a cheap way to check that a change has been applied.
+func (p *Provider) GetZoneSerial(ctx context.Context, zone string) (uint32, error) {
+	zone = p.zoneOrDefault(zone)
+	defer p.lockZone(zone)()
+
+	dnsClient, err := p.initClient(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	domainID, err := p.getDomainID(ctx, dnsClient, zone)
+	if err != nil {
+		return 0, err
+	}
+
+	recordList, err := dnsClient.getRecords(ctx, domainID, "SOA")
+	if err != nil {
+		p.forgetDomainIDOnNotFound(zone, err)
+		return 0, err
+	}
+	if len(recordList.Records) == 0 {
+		return 0, fmt.Errorf("no SOA record in zone %s", zone)
+	}
+
+	rec, err := convertToLibdnsRecord(recordList.Records[0])
+	if err != nil {
+		return 0, err
+	}
+	return rec.(SOA).Serial, nil
+}
+
+// EnsureAction reports what EnsureRecord did.
+type EnsureAction string
+
+const (
+	EnsureCreated   EnsureAction = "created"   // No record had the name and type, so one was created
+	EnsureUpdated   EnsureAction = "updated"   // A record with the name and type was changed to the data
+	EnsureUnchanged EnsureAction = "unchanged" // The record already existed
+)
+
+// EnsureRecord makes sure that rec exists in the zone, without touching the other records of
+// its rrset as SetRecords does. A record with the same name, type and data is left as is;
+// otherwise the first record with the same name and type is updated to rec's data, or rec is
+// created if there is none. It returns the record as stored by ConoHa and what was done.
+func (p *Provider) EnsureRecord(ctx context.Context, zone string, rec libdns.Record) (libdns.Record, EnsureAction, error) {
+	zone = p.zoneOrDefault(zone)
+	defer p.lockZone(zone)()
+
+	want, err := p.toConohaDNSRecord(rec)
+	if err != nil {
+		return nil, "", recordError(rec, err)
+	}
+
+	dnsClient, err := p.initClient(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	domainID, err := p.getDomainID(ctx, dnsClient, zone)
+	if err != nil {
+		return nil, "", err
+	}
+
+	existing, err := dnsClient.getRecords(ctx, domainID, want.Type)
+	if err != nil {
+		p.forgetDomainIDOnNotFound(zone, err)
+		return nil, "", err
+	}
+
+	var sameName *conohaDNSRecord
+	for i, have := range existing.Records {
+		if keyOf(have) == keyOf(want) {
+			return convertToLibdnsRecordOrRR(have), EnsureUnchanged, nil
+		}
+		if sameName == nil && strings.EqualFold(have.Name, want.Name) {
+			sameName = &existing.Records[i]
+		}
+	}
+
+	if sameName == nil {
+		created, err := dnsClient.createRecord(ctx, domainID, want)
+		if err != nil {
+			return nil, "", recordError(rec, err)
+		}
+		return convertToLibdnsRecordOrRR(*created), EnsureCreated, nil
+	}
+
+	if want.GSLB == (GSLB{}) {
+		// Keep the routing attributes of the replaced record unless new ones are given.
+		want.GSLB = sameName.GSLB
+	}
+	if want.Description == "" {
+		want.Description = sameName.Description
+	}
+
+	var stored *conohaDNSRecord
+	if p.PreserveTTLOnUpdate && ttlDiffers(*sameName, want) {
+		stored, err = recreateRecord(ctx, dnsClient, domainID, *sameName, want)
+	} else {
+		stored, err = dnsClient.updateRecord(ctx, domainID, sameName.UUID, want)
+	}
+	if err != nil {
+		return nil, "", recordError(rec, err)
+	}
+	return convertToLibdnsRecordOrRR(*stored), EnsureUpdated, nil
+}
+
+// AppendRecords adds the specified records to the zone.
+// It returns the successfully added records as stored by ConoHa, carrying their UUIDs in ProviderData
+// and the TTL ConoHa actually applied.
+// A failing record does not stop the batch; the failures are returned as a joined error.
+// Records identical to an existing one are not created; the existing record is returned instead.
+// Duplicate input records are created and returned only once.
+// Records that would make a CNAME share its name with other records fail with ErrCNAMEConflict.
+func (p *Provider) AppendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	zone = p.zoneOrDefault(zone)
+	defer p.lockZone(zone)()
+
+	dnsClient, err := p.initClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	domainID, err := p.getDomainID(ctx, dnsClient, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	// Records already stored with the same name, type and data are not created again.
+	existing, err := dnsClient.getRecords(ctx, domainID, "")
+	if err != nil {
+		p.forgetDomainIDOnNotFound(zone, err)
+		return nil, err
+	}
+	present := make(map[recordKey]conohaDNSRecord, len(existing.Records))
+	for _, rec := range existing.Records {
+		present[keyOf(rec)] = rec
+	}
+
+	results := make([]libdns.Record, len(records))
+	errs := make([]error, len(records))
+
+	// Duplicates within the input are created once and returned once.
+	rawRecords := make([]conohaDNSRecord, len(records))
+	unique := make([]bool, len(records))
+	requested := map[recordKey]bool{}
+	for i, rec := range records {
+		rawRecord, err := p.toConohaDNSRecord(rec)
+		if err != nil {
+			errs[i] = recordError(rec, err)
+			continue
+		}
+		if key := keyOf(rawRecord); !requested[key] {
+			requested[key] = true
+			rawRecords[i], unique[i] = rawRecord, true
+		}
+	}
+
+	// A CNAME can't share its name with other records, whether stored or requested.
+	types := nameTypes{}
+	for _, rec := range existing.Records {
+		types.add(rec)
+	}
+	for i := range records {
+		if unique[i] {
+			types.add(rawRecords[i])
+		}
+	}
+	for i, rec := range records {
+		if !unique[i] {
+			continue
+		}
+		if err := types.cnameConflict(rawRecords[i]); err != nil {
+			errs[i] = recordError(rec, err)
+			unique[i] = false
+		}
+	}
+
+	// Records are created by up to p.concurrency() workers; results keep the input order.
+	sem := make(chan struct{}, p.concurrency())
+	var wg sync.WaitGroup
+	for i, rec := range records {
+		if !unique[i] {
+			continue
+		}
+		i, rec := i, rec
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i], errs[i] = appendRecord(ctx, dnsClient, domainID, present, rec, rawRecords[i])
+		}()
+	}
+	wg.Wait()
+
+	var created []libdns.Record
+	for _, result := range results {
+		if result != nil {
+			created = append(created, result)
+		}
+	}
+
+	err = errors.Join(errs...)
+	p.forgetDomainIDOnNotFound(zone, err)
+
+	return created, err
+}
+
+// appendRecord creates rec, converted as rawRecord, and returns it as stored by ConoHa.
+// If an identical record is already present, it is returned instead and marked as such.
+// This includes records created concurrently by someone else, which ConoHa rejects with HTTP 409.
+func appendRecord(ctx context.Context, dnsClient *dnsClient, domainID string, present map[recordKey]conohaDNSRecord, rec libdns.Record, rawRecord conohaDNSRecord) (libdns.Record, error) {
+	if old, ok := present[keyOf(rawRecord)]; ok {
+		return alreadyPresent(rec, old), nil
+	}
+
+	newRecord, err := dnsClient.createRecord(ctx, domainID, rawRecord)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict {
+		if old, lookupErr := dnsClient.getRecord(ctx, domainID, rawRecord.Name, rawRecord.Type, rawRecord.Data); lookupErr == nil {
+			return alreadyPresent(rec, *old), nil
+		}
+	}
+	if err != nil {
+		return nil, recordError(rec, err)
+	}
+
+	libRecord, err := convertToLibdnsRecord(*newRecord)
+	if err != nil {
+		// The record was created; fall back to the input if the response can't be mapped.
+		return rec, nil
+	}
+
+	return libRecord, nil
+}
+
+// alreadyPresent returns the stored record old, which rec duplicates, marked as already present.
+// It falls back to rec if old can't be mapped.
+func alreadyPresent(rec libdns.Record, old conohaDNSRecord) libdns.Record {
+	meta, _ := recordProviderData(old).(RecordMetadata)
+	meta.AlreadyPresent = true
+	libRecord, err := newLibdnsRecord(old, meta)
+	if err != nil {
+		return rec
+	}
+	return libRecord
+}
+
+// concurrency returns how many records may be created in parallel.
+func (p *Provider) concurrency() int {
+	switch {
+	case p.Concurrency <= 0:
+		return 1
+	case p.Concurrency > maxConcurrency:
+		return maxConcurrency
+	default:
+		return p.Concurrency
+	}
+}
+
+// SetRecords sets the records in the zone, updating existing ones or creating new ones.
+// For every (name, type) pair in the input, the records stored in ConoHa are made to
+// match exactly the provided values: stale records are updated in place where possible,
+// missing ones are created and any left over are deleted.
+// Records are compared like RecordsEqual without TTLs: names case-insensitively, and a record
+// differing only by its TTL is never updated, since ConoHa rejects TTL changes on update.
+// Created records get the requested TTL, while records updated in place keep their stored TTL.
+// With PreserveTTLOnUpdate, TTL changes are applied by recreating the record instead.
+// Rrsets that would make a CNAME share its name with other records fail with ErrCNAMEConflict.
+// Rrsets holding a record read from ConoHa that was changed since fail with a *RecordConflictError.
+// It returns the records of the rrsets that were reconciled successfully, as stored by ConoHa,
+// so that they carry the UUID and UpdatedAt to pass to a later SetRecords;
+// failures are returned as a joined error.
+func (p *Provider) SetRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	zone = p.zoneOrDefault(zone)
+	defer p.lockZone(zone)()
+
+	dnsClient, err := p.initClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	domainID, err := p.getDomainID(ctx, dnsClient, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []rrsetKey
+	var errs []error
+	desired := map[rrsetKey][]conohaDNSRecord{}
+	inputs := map[rrsetKey][]libdns.Record{}
+	for _, rec := range records {
+		converted, err := p.toConohaDNSRecord(rec)
+		if err != nil {
+			errs = append(errs, recordError(rec, err))
+			continue
+		}
+
+		key := rrsetKey{name: strings.ToLower(converted.Name), rtype: converted.Type}
+		if _, ok := desired[key]; !ok {
+			keys = append(keys, key)
+		}
+		desired[key] = append(desired[key], converted)
+		inputs[key] = append(inputs[key], rec)
+	}
+
+	recordList, err := dnsClient.getRecords(ctx, domainID, "")
+	if err != nil {
+		p.forgetDomainIDOnNotFound(zone, err)
+		return nil, err
+	}
+
+	existing := map[rrsetKey][]conohaDNSRecord{}
+	byUUID := map[string]conohaDNSRecord{}
+	types := nameTypes{}
+	for _, record := range recordList.Records {
+		key := rrsetKey{name: strings.ToLower(record.Name), rtype: record.Type}
+		existing[key] = append(existing[key], record)
+		byUUID[record.UUID] = record
+		types.add(record)
+	}
+	for _, key := range keys {
+		types.add(desired[key][0])
+	}
+
+	var set []libdns.Record
+	for _, key := range keys {
+		var stored []conohaDNSRecord
+		err := checkUnchanged(byUUID, inputs[key])
+		if err == nil {
+			err = types.cnameConflict(desired[key][0])
+		}
+		if err == nil {
+			stored, err = p.reconcileRRSet(ctx, dnsClient, domainID, existing[key], desired[key])
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rrset %s %q: %w", key.rtype, key.name, err))
+			continue
+		}
+		for _, record := range stored {
+			set = append(set, convertToLibdnsRecordOrRR(record))
+		}
+	}
+
+	err = errors.Join(errs...)
+	p.forgetDomainIDOnNotFound(zone, err)
+
+	return set, err
+}
+
+// ZoneResult is the outcome of SetRecordsMulti for one zone.
+type ZoneResult struct {
+	Records []libdns.Record // Records set, as returned by SetRecords
+	Err     error           // Error returned by SetRecords, if any
+}
+
+// SetRecordsMulti calls SetRecords for each zone of records, which maps zone names to
+// their records, and returns the result of each zone. The zones share one token and
+// are processed one after another, in name order; a failing zone doesn't stop the others.
+// An error is returned only when the provider can't authenticate.
+func (p *Provider) SetRecordsMulti(ctx context.Context, records map[string][]libdns.Record) (map[string]ZoneResult, error) {
+	if _, err := p.initClient(ctx); err != nil {
+		return nil, err
+	}
+
+	zones := make([]string, 0, len(records))
+	for zone := range records {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+
+	results := make(map[string]ZoneResult, len(records))
+	for _, zone := range zones {
+		set, err := p.SetRecords(ctx, zone, records[zone])
+		results[zone] = ZoneResult{Records: set, Err: err}
+	}
+
+	return results, nil
+}
+
+// checkUnchanged returns a *RecordConflictError if one of records was read from ConoHa,
+// its metadata carrying a UUID and UpdatedAt, and the stored record, looked up in stored by UUID,
+// has since been updated or deleted. Records without an UpdatedAt are not checked.
+// ConoHa has no conditional updates, so a change made after stored was listed goes unnoticed.
+func checkUnchanged(stored map[string]conohaDNSRecord, records []libdns.Record) error {
+	for _, rec := range records {
+		meta := recordMetadata(rec)
+		if meta.UUID == "" || meta.UpdatedAt.IsZero() {
+			continue
+		}
+		if current := stored[meta.UUID]; !current.UpdatedAt.Equal(meta.UpdatedAt) {
+			return &RecordConflictError{UUID: meta.UUID, Read: meta.UpdatedAt, Stored: current.UpdatedAt}
+		}
+	}
+	return nil
+}
+
+// recordKey identifies a single record by its name, type and data.
+type recordKey struct {
+	name  string
+	rtype string
+	data  string
+}
+
+// keyOf returns the recordKey of rec. Names are compared case-insensitively.
+func keyOf(rec conohaDNSRecord) recordKey {
+	return recordKey{name: strings.ToLower(rec.Name), rtype: rec.Type, data: rec.Data}
+}
+
+// rrsetKey identifies the set of records sharing a name, lowercased, and type.
+type rrsetKey struct {
+	name  string
+	rtype string
+}
+
+// reconcileRRSet makes the stored records of one rrset (have) match the desired ones (want).
+// Records whose data already matches are left untouched, unless a new description is given;
+// the remaining ones are updated in place, then missing records are created and extra records deleted.
+// With PreserveTTLOnUpdate, records whose TTL must change are recreated instead.
+// It returns the resulting records as stored by ConoHa, one per distinct desired data.
+func (p *Provider) reconcileRRSet(ctx context.Context, dnsClient *dnsClient, domainID string, have, want []conohaDNSRecord) ([]conohaDNSRecord, error) {
+	matched := make([]bool, len(have))
+	seen := map[string]bool{}
+
+	var stored, missing []conohaDNSRecord
+	for _, w := range want {
+		if seen[w.Data] {
+			continue
+		}
+		seen[w.Data] = true
+
+		found := false
+		for i, h := range have {
+			if !matched[i] && h.Data == w.Data {
+				matched[i] = true
+				found = true
+
+				kept := &h
+				var err error
+				if p.PreserveTTLOnUpdate && ttlDiffers(h, w) {
+					kept, err = recreateRecord(ctx, dnsClient, domainID, h, w)
+				} else if w.Description != "" && w.Description != h.Description {
+					if w.GSLB == (GSLB{}) {
+						w.GSLB = h.GSLB
+					}
+					kept, err = dnsClient.updateRecord(ctx, domainID, h.UUID, w)
+				}
+				if err != nil {
+					return nil, err
+				}
+				stored = append(stored, *kept)
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, w)
+		}
+	}
+
+	var stale []conohaDNSRecord
+	for i, h := range have {
+		if !matched[i] {
+			stale = append(stale, h)
+		}
+	}
+
+	for i, w := range missing {
+		if i < len(stale) && w.GSLB == (GSLB{}) {
+			// Keep the routing attributes of the replaced record unless new ones are given.
+			w.GSLB = stale[i].GSLB
+		}
+		if i < len(stale) && w.Description == "" {
+			w.Description = stale[i].Description
+		}
+
+		var written *conohaDNSRecord
+		var err error
+		if i < len(stale) && p.PreserveTTLOnUpdate && ttlDiffers(stale[i], w) {
+			written, err = recreateRecord(ctx, dnsClient, domainID, stale[i], w)
+		} else if i < len(stale) {
+			written, err = dnsClient.updateRecord(ctx, domainID, stale[i].UUID, w)
+		} else {
+			written, err = dnsClient.createRecord(ctx, domainID, w)
+		}
+		if err != nil {
+			return nil, err
+		}
+		stored = append(stored, *written)
+	}
+
+	for i := len(missing); i < len(stale); i++ {
+		if err := dnsClient.deleteRecord(ctx, domainID, stale[i].UUID); err != nil {
+			return nil, err
+		}
+	}
+
+	return stored, nil
+}
+
+// RecordsEqual reports whether a and b describe the same record: same name (case-insensitively),
+// type and data, compared in the form sent to ConoHa so that equivalent values match.
+// TTLs are compared only if compareTTL is true; ConoHa doesn't always preserve them on updates,
+// so diffing usually ignores them.
+func RecordsEqual(a, b libdns.Record, compareTTL bool) bool {
+	rawA, errA := convertToConohaDNSRecord(a)
+	rawB, errB := convertToConohaDNSRecord(b)
+	if errA != nil || errB != nil {
+		// Fall back to the generic representation for records that can't be written.
+		rrA, rrB := a.RR(), b.RR()
+		rawA = conohaDNSRecord{Name: rrA.Name, Type: rrA.Type, Data: rrA.Data, TTL: int(rrA.TTL.Seconds())}
+		rawB = conohaDNSRecord{Name: rrB.Name, Type: rrB.Type, Data: rrB.Data, TTL: int(rrB.TTL.Seconds())}
+	}
+
+	if keyOf(rawA) != keyOf(rawB) {
+		return false
+	}
+	return !compareTTL || rawA.TTL == rawB.TTL
+}
+
+// ttlDiffers reports whether want requests a TTL different from the one stored in have.
+func ttlDiffers(have, want conohaDNSRecord) bool {
+	return want.TTL != 0 && have.TTL != want.TTL
+}
+
+// recreateRecord replaces old with record by creating it and deleting old, which is the only
+// way to change the TTL of a ConoHa record, and returns the record as stored by ConoHa.
+// When ConoHa rejects the new record as a duplicate of old, i.e. only the TTL changes,
+// old is deleted first and recreated if the creation then fails. An error leaving old
+// deleted names its UUID.
+func recreateRecord(ctx context.Context, dnsClient *dnsClient, domainID string, old, record conohaDNSRecord) (*conohaDNSRecord, error) {
+	created, err := dnsClient.createRecord(ctx, domainID, record)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		if err != nil {
+			return nil, err
+		}
+		if err := dnsClient.deleteRecord(ctx, domainID, old.UUID); err != nil {
+			return nil, fmt.Errorf("replacement of record %s created as %s, but deleting it failed: %w", old.UUID, created.UUID, err)
+		}
+		return created, nil
+	}
+
+	if err := dnsClient.deleteRecord(ctx, domainID, old.UUID); err != nil {
+		return nil, err
+	}
+	created, err = dnsClient.createRecord(ctx, domainID, record)
+	if err == nil {
+		return created, nil
+	}
+
+	restore := old
+	restore.UUID = ""
+	restored, restoreErr := dnsClient.createRecord(ctx, domainID, restore)
+	if restoreErr != nil {
+		return nil, fmt.Errorf("record %s deleted to change its TTL, but neither the new record nor the old one could be created: %w", old.UUID, errors.Join(err, restoreErr))
+	}
+	return nil, fmt.Errorf("record %s deleted to change its TTL and restored as %s, as creating the new record failed: %w", old.UUID, restored.UUID, err)
+}
+
+// DeleteRecords deletes the specified records from the zone.
+// Records carrying a UUID in their ProviderData, as returned by GetRecords, are deleted by that UUID.
+// A record without data deletes every record with its name and type.
+// It returns the records that were successfully deleted, the stored ones for records without data;
+// failures are returned as a joined error.
+func (p *Provider) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	zone = p.zoneOrDefault(zone)
+	defer p.lockZone(zone)()
+
+	dnsClient, err := p.initClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	domainID, err := p.getDomainID(ctx, dnsClient, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	// The zone is listed at most once, when the first record without a UUID is looked up.
+	index := &recordIndex{list: func() ([]conohaDNSRecord, error) {
+		recordList, err := dnsClient.getRecords(ctx, domainID, "")
+		if err != nil {
+			return nil, err
+		}
+		return recordList.Records, nil
+	}}
+
+	// Records deleted by UUID are claimed first, so that the other records can't match them.
+	for _, rec := range records {
+		if id := recordMetadata(rec).UUID; id != "" {
+			index.claim(id)
+		}
+	}
+
+	var deleted []libdns.Record
+	var errs []error
+	for _, rec := range records {
+		targets, err := deletionTargets(index, rec)
+		if errors.Is(err, errRecordNotFound) {
+			// Records that don't exist are silently ignored, as required by libdns.
+			continue
+		}
+		if err != nil {
+			errs = append(errs, recordError(rec, err))
+			continue
+		}
+
+		wildcard := recordMetadata(rec).UUID == "" && rec.RR().Data == ""
+		for _, target := range targets {
+			if err := dnsClient.deleteRecord(ctx, domainID, target.UUID); err != nil {
+				errs = append(errs, recordError(rec, err))
+				continue
+			}
+			if wildcard {
+				deleted = append(deleted, convertToLibdnsRecordOrRR(target))
+			} else {
+				deleted = append(deleted, rec)
+			}
+		}
+	}
+
+	err = errors.Join(errs...)
+	p.forgetDomainIDOnNotFound(zone, err)
+
+	return deleted, err
+}
+
+// deletionTargets returns the stored records to delete for rec.
+// A UUID carried in rec's ProviderData, e.g. from GetRecords, identifies the record exactly.
+// Otherwise, a record with data is looked up in index by name, type and data, and one
+// without data matches every record with its name and type, as libdns requires.
+func deletionTargets(index *recordIndex, rec libdns.Record) ([]conohaDNSRecord, error) {
+	if id := recordMetadata(rec).UUID; id != "" {
+		return []conohaDNSRecord{{UUID: id}}, nil
+	}
+
+	if rr := rec.RR(); rr.Data == "" {
+		// Records without data can't be converted, as most types need their data to parse.
+		return index.findAll(recordKey{name: strings.ToLower(rr.Name), rtype: strings.ToUpper(rr.Type)})
+	}
+
+	converted, err := convertToConohaDNSRecord(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := index.find(keyOf(converted))
+	if err != nil {
+		return nil, err
+	}
+	return []conohaDNSRecord{found}, nil
+}
+
+// recordIndex maps the name, type and data of the records of a zone to the records.
+// The records are listed on the first lookup only; a listing failure is returned by every lookup.
+type recordIndex struct {
+	list    func() ([]conohaDNSRecord, error)
+	listed  bool
+	listErr error
+
+	records map[recordKey][]conohaDNSRecord // Also indexed with empty data, to look up by name and type
+	claimed map[string]bool                 // UUIDs already returned by find or findAll, or passed to claim
+}
+
+// claim keeps find and findAll from returning the record with the given UUID.
+func (idx *recordIndex) claim(id string) {
+	if idx.claimed == nil {
+		idx.claimed = map[string]bool{}
+	}
+	idx.claimed[id] = true
+}
+
+// load lists the records on the first call and returns the listing error, if any.
+func (idx *recordIndex) load() error {
+	if !idx.listed {
+		idx.listed = true
+
+		var records []conohaDNSRecord
+		records, idx.listErr = idx.list()
+		idx.records = make(map[recordKey][]conohaDNSRecord, 2*len(records))
+		if idx.claimed == nil {
+			idx.claimed = map[string]bool{}
+		}
+		for _, rec := range records {
+			byData := keyOf(rec)
+			byNameType := recordKey{name: byData.name, rtype: byData.rtype}
+			idx.records[byData] = append(idx.records[byData], rec)
+			idx.records[byNameType] = append(idx.records[byNameType], rec)
+		}
+	}
+	return idx.listErr
+}
+
+// find returns a record matching key that wasn't returned before, so that
+// several identical lookups yield distinct records. Keys with empty data match any data.
+func (idx *recordIndex) find(key recordKey) (conohaDNSRecord, error) {
+	if err := idx.load(); err != nil {
+		return conohaDNSRecord{}, err
+	}
+
+	for _, rec := range idx.records[key] {
+		if !idx.claimed[rec.UUID] {
+			idx.claimed[rec.UUID] = true
+			return rec, nil
+		}
+	}
+	return conohaDNSRecord{}, errRecordNotFound
+}
+
+// findAll returns every record matching key that wasn't returned before.
+func (idx *recordIndex) findAll(key recordKey) ([]conohaDNSRecord, error) {
+	if err := idx.load(); err != nil {
+		return nil, err
+	}
+
+	var found []conohaDNSRecord
+	for _, rec := range idx.records[key] {
+		if !idx.claimed[rec.UUID] {
+			idx.claimed[rec.UUID] = true
+			found = append(found, rec)
+		}
+	}
+	if len(found) == 0 {
+		return nil, errRecordNotFound
+	}
+	return found, nil
+}
+
+// DeleteAllRecords deletes every record in the zone with the given name and type, both compared
+// case-insensitively, such as all "_acme-challenge" TXT records. If data is not empty, only records whose
+// value (as in libdns.RR.Data) equals data are deleted.
+// It returns the records that were successfully deleted; failures are returned as a joined error.
+func (p *Provider) DeleteAllRecords(ctx context.Context, zone, name, rtype, data string) ([]libdns.Record, error) {
+	rtype = strings.ToUpper(rtype)
+	zone = p.zoneOrDefault(zone)
+	defer p.lockZone(zone)()
+
+	dnsClient, err := p.initClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	domainID, err := p.getDomainID(ctx, dnsClient, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	rawRecordList, err := dnsClient.getRecords(ctx, domainID, rtype)
+	if err != nil {
+		p.forgetDomainIDOnNotFound(zone, err)
+		return nil, err
+	}
+
+	var deleted []libdns.Record
+	var errs []error
+	for _, record := range rawRecordList.Records {
+		if !strings.EqualFold(record.Name, name) || record.Type != rtype {
+			continue
+		}
+
+		// Unsupported or malformed records can still be deleted.
+		libRecord := convertToLibdnsRecordOrRR(record)
+		if data != "" && libRecord.RR().Data != data {
+			continue
+		}
+
+		if err := dnsClient.deleteRecord(ctx, domainID, record.UUID); err != nil {
+			errs = append(errs, recordError(libRecord, err))
+			continue
+		}
+		deleted = append(deleted, libRecord)
+	}
+
+	err = errors.Join(errs...)
+	p.forgetDomainIDOnNotFound(zone, err)
+
+	return deleted, err
+}
+
+// toConohaDNSRecord converts rec for writing, applying the provider's record defaults.
+func (p *Provider) toConohaDNSRecord(rec libdns.Record) (conohaDNSRecord, error) {
+	converted, err := convertToConohaDNSRecord(rec)
+	if err != nil {
+		return conohaDNSRecord{}, err
+	}
+	if p.wantsMinTTL(converted.Name) {
+		if converted.TTL < minTTL {
+			converted.TTL = minTTL
+		}
+	} else if converted.TTL == 0 && p.DefaultTTL > 0 {
+		converted.TTL = int(p.DefaultTTL.Seconds())
+	}
+	if err := validateRecord(converted); err != nil {
+		return conohaDNSRecord{}, err
+	}
+	meta := recordMetadata(rec)
+	converted.GSLB, converted.Description = meta.GSLB, meta.Description
+
+	return converted, nil
+}
+
+// wantsMinTTL reports whether the first label of name matches one of MinTTLPatterns, case-insensitively.
+func (p *Provider) wantsMinTTL(name string) bool {
+	label, _, _ := strings.Cut(strings.ToLower(name), ".")
+	for _, pattern := range p.MinTTLPatterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), label); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// TTL bounds enforced by ConoHa, in seconds.
+const (
+	minTTL = 60
+	maxTTL = 86400
+)
+
+// validateRecord checks that rec holds data and a TTL ConoHa accepts for its type,
+// so that mistakes are reported locally instead of as an HTTP 400.
+// Out-of-range TTLs are rejected rather than clamped, so that no record is silently altered.
+func validateRecord(rec conohaDNSRecord) error {
+	if rec.Name == "" {
+		return fmt.Errorf("%w: name is empty", ErrInvalidRecord)
+	}
+	if rec.TTL != 0 && (rec.TTL < minTTL || rec.TTL > maxTTL) {
+		return fmt.Errorf("%w: TTL %ds is outside ConoHa's range of %ds to %ds", ErrInvalidRecord, rec.TTL, minTTL, maxTTL)
+	}
+
+	switch rec.Type {
+	case "A", "AAAA":
+		ip, err := netip.ParseAddr(rec.Data)
+		if err != nil {
+			return fmt.Errorf("%w: %q is not an IP address", ErrInvalidRecord, rec.Data)
+		}
+		if rec.Type == "A" && !ip.Is4() {
+			return fmt.Errorf("%w: A record data %q is not an IPv4 address", ErrInvalidRecord, rec.Data)
+		}
+		if rec.Type == "AAAA" && (!ip.Is6() || ip.Is4In6()) {
+			return fmt.Errorf("%w: AAAA record data %q is not an IPv6 address", ErrInvalidRecord, rec.Data)
+		}
+	case "CNAME", "NS", "ALIAS":
+		if rec.Data == "" {
+			return fmt.Errorf("%w: %s target is empty", ErrInvalidRecord, rec.Type)
+		}
+	}
+
+	return nil
 }
 
-// initClient initializes a new DNS API client with an authentication token.
-func (p *Provider) initClient(ctx context.Context) (*dnsClient, error) {
-	identifier, err := newIdentifier(p.Region)
-	if err != nil {
-		return nil, err
+// recordError annotates err with the type and name of the record it relates to.
+func recordError(rec libdns.Record, err error) error {
+	rr := rec.RR()
+	return fmt.Errorf("record %s %q: %w", rr.Type, rr.Name, err)
+}
+
+// nameTypes holds the types of the records at each name, keyed by lowercased name.
+type nameTypes map[string]map[string]bool
+
+// add records the type of rec at its name.
+func (nt nameTypes) add(rec conohaDNSRecord) {
+	name := strings.ToLower(rec.Name)
+	if nt[name] == nil {
+		nt[name] = map[string]bool{}
 	}
+	nt[name][rec.Type] = true
+}
 
-	token, err := identifier.getToken(ctx, p.APITenantID, p.APIUserID, p.APIPassword)
-	if err != nil {
-		return nil, err
+// cnameConflict returns an error wrapping ErrCNAMEConflict if rec is a CNAME record sharing
+// its name with records of other types, or another record sharing its name with a CNAME record.
+// A CNAME must be the only record at its name (RFC 1034, section 3.6.2).
+func (nt nameTypes) cnameConflict(rec conohaDNSRecord) error {
+	types := nt[strings.ToLower(rec.Name)]
+	if rec.Type != "CNAME" {
+		if types["CNAME"] {
+			return fmt.Errorf("%w: %q has a CNAME record", ErrCNAMEConflict, rec.Name)
+		}
+		return nil
+	}
+
+	var others []string
+	for rtype := range types {
+		if rtype != "CNAME" {
+			others = append(others, rtype)
+		}
+	}
+	if len(others) > 0 {
+		sort.Strings(others)
+		return fmt.Errorf("%w: %q has %s records", ErrCNAMEConflict, rec.Name, strings.Join(others, ", "))
 	}
+	return nil
+}
+
+// RefreshToken discards the cached token and authenticates again right away, e.g. after the
+// API password was rotated, instead of waiting for ConoHa to reject the old token.
+// If authentication fails, the next call authenticates again.
+func (p *Provider) RefreshToken(ctx context.Context) error {
+	p.mutex.Lock()
+	p.token = nil
+	p.mutex.Unlock()
 
-	return newDnsClient(p.Region, token)
+	_, err := p.initClient(ctx)
+	return err
 }
 
-// GetRecords lists all the DNS records in the specified zone.
-func (p *Provider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+// Ping checks the credentials and the connectivity to ConoHa, for example before a long job.
+// It obtains a fresh token, even if one is cached, then lists the zones of the account.
+func (p *Provider) Ping(ctx context.Context) error {
 	p.mutex.Lock()
-	defer p.mutex.Unlock()
+	p.token = nil
+	p.mutex.Unlock()
 
 	dnsClient, err := p.initClient(ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	domainID, err := dnsClient.getDomainID(ctx, zone)
+	if _, err := dnsClient.getDomains(ctx); err != nil {
+		return fmt.Errorf("DNS service check failed: %w", err)
+	}
+
+	return nil
+}
+
+// ListZones returns all DNS zones (domains) managed by the account.
+func (p *Provider) ListZones(ctx context.Context) ([]libdns.Zone, error) {
+	dnsClient, err := p.initClient(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	rawRecordList, err := dnsClient.getRecords(ctx, domainID)
+	domainList, err := dnsClient.getDomains(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	var libRecords []libdns.Record
-	for _, record := range rawRecordList.Records {
-		libRecord, err := convertToLibdnsRecord(record)
-		if err != nil {
-			if err == errRecordNotSupported {
-				continue
-			}
-			return nil, err
-		}
-		libRecords = append(libRecords, libRecord)
+	zones := make([]libdns.Zone, 0, len(domainList.Domains))
+	for _, domain := range domainList.Domains {
+		zones = append(zones, libdns.Zone{Name: domain.Name})
 	}
 
-	return libRecords, nil
+	return zones, nil
 }
 
-// AppendRecords adds the specified records to the zone.
-// It returns the successfully added records.
-func (p *Provider) AppendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-	p.mutex.Lock()
-	defer p.mutex.Unlock()
-
-	dnsClient, err := p.initClient(ctx)
+// ListZonesMatching returns the zones of the account named suffix or under it, e.g. "example.com."
+// matches "example.com." and "sub.example.com." but not "notexample.com.".
+// Names are compared case-insensitively, with or without a trailing dot. An empty suffix matches every zone.
+func (p *Provider) ListZonesMatching(ctx context.Context, suffix string) ([]libdns.Zone, error) {
+	zones, err := p.ListZones(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	domainID, err := dnsClient.getDomainID(ctx, zone)
-	if err != nil {
-		return nil, err
+	suffix = strings.ToLower(strings.Trim(suffix, "."))
+	if suffix == "" {
+		return zones, nil
 	}
 
-	for _, rec := range records {
-		rawRecord, err := convertToConohaDNSRecord(rec)
-		if err != nil {
-			return nil, err
-		}
-
-		_, err = dnsClient.createRecord(ctx, domainID, rawRecord)
-		if err != nil {
-			return nil, err
+	var matching []libdns.Zone
+	for _, zone := range zones {
+		name := strings.ToLower(strings.TrimSuffix(zone.Name, "."))
+		if name == suffix || strings.HasSuffix(name, "."+suffix) {
+			matching = append(matching, zone)
 		}
 	}
 
-	return records, nil
+	return matching, nil
 }
 
-// SetRecords sets the records in the zone, updating existing ones or creating new ones.
-// It returns the records that were updated or added.
-func (p *Provider) SetRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-	p.mutex.Lock()
-	defer p.mutex.Unlock()
+// CreateZone creates a new DNS zone (domain) named name.
+// The email is the administrative contact required by ConoHa for the zone's SOA record.
+// If it is empty, DefaultZoneEmail is used; a missing or malformed address fails without any request.
+// It returns the name and UUID of the new zone.
+func (p *Provider) CreateZone(ctx context.Context, name, email string) (ZoneInfo, error) {
+	defer p.lockZone(name)()
+
+	if email == "" {
+		email = p.DefaultZoneEmail
+	}
+	if email == "" {
+		return ZoneInfo{}, errors.New("an email address is required to create a zone")
+	}
+	if err := validateEmail(email); err != nil {
+		return ZoneInfo{}, err
+	}
 
 	dnsClient, err := p.initClient(ctx)
 	if err != nil {
-		return nil, err
+		return ZoneInfo{}, err
 	}
 
-	domainID, err := dnsClient.getDomainID(ctx, zone)
+	if planner := dnsClient.plan(); planner != nil {
+		planner.add(ctx, PlannedChange{Action: "create", Zone: name})
+		return ZoneInfo{Name: name}, nil
+	}
+
+	created, err := dnsClient.createDomain(ctx, domain{Name: name, Email: email})
 	if err != nil {
-		return nil, err
+		return ZoneInfo{}, err
 	}
 
-	for _, rec := range records {
-		converted, err := convertToConohaDNSRecord(rec)
-		if err != nil {
-			return nil, err
-		}
+	p.cacheDomainID(created.Name, created.UUID)
 
-		recordID, err := dnsClient.getRecordID(ctx, domainID, converted.Name, converted.Type)
-		if err != nil {
-			if errors.Is(err, errRecordNotFound) {
-				_, err = dnsClient.createRecord(ctx, domainID, converted)
-				if err != nil {
-					return nil, err
-				}
-				continue
-			}
-			return nil, err
-		}
+	return ZoneInfo{Name: created.Name, UUID: created.UUID}, nil
+}
 
-		_, err = dnsClient.updateRecord(ctx, domainID, recordID, converted)
-		if err != nil {
-			return nil, err
+// UpdateZoneSOA changes the SOA parameters of the zone named name; zero fields of soa are left
+// unchanged. It returns the parameters stored by ConoHa after the update.
+func (p *Provider) UpdateZoneSOA(ctx context.Context, name string, soa ZoneSOA) (ZoneSOA, error) {
+	defer p.lockZone(name)()
+
+	if soa.Email == "" && soa.TTL == 0 {
+		return ZoneSOA{}, errors.New("no SOA parameter to update")
+	}
+	if soa.Email != "" {
+		if err := validateEmail(soa.Email); err != nil {
+			return ZoneSOA{}, err
 		}
 	}
+	if soa.TTL != 0 && (soa.TTL < minTTL*time.Second || soa.TTL > maxTTL*time.Second) {
+		return ZoneSOA{}, fmt.Errorf("TTL %v is outside ConoHa's range of %ds to %ds", soa.TTL, minTTL, maxTTL)
+	}
+
+	dnsClient, err := p.initClient(ctx)
+	if err != nil {
+		return ZoneSOA{}, err
+	}
+
+	domainID, err := p.getDomainID(ctx, dnsClient, name)
+	if err != nil {
+		return ZoneSOA{}, err
+	}
+
+	if planner := dnsClient.plan(); planner != nil {
+		planner.add(ctx, PlannedChange{Action: "update", Zone: name})
+		return soa, nil
+	}
 
-	return records, nil
+	updated, err := dnsClient.updateDomain(ctx, domainID, domainUpdate{Email: soa.Email, TTL: int(soa.TTL.Seconds())})
+	if err != nil {
+		p.forgetDomainIDOnNotFound(name, err)
+		return ZoneSOA{}, err
+	}
+
+	return ZoneSOA{Email: updated.Email, TTL: time.Duration(updated.TTL) * time.Second}, nil
 }
 
-// DeleteRecords deletes the specified records from the zone.
-// It returns the records that were successfully deleted.
-func (p *Provider) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-	p.mutex.Lock()
-	defer p.mutex.Unlock()
+// validateEmail checks that email is a bare address such as "hostmaster@example.com",
+// without a display name or angle brackets.
+func validateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return fmt.Errorf("malformed email address %q", email)
+	}
+	return nil
+}
+
+// DeleteZone deletes the DNS zone (domain) named name, along with all of its records.
+// It returns an error wrapping ErrZoneNotFound if the zone doesn't exist.
+func (p *Provider) DeleteZone(ctx context.Context, name string) error {
+	defer p.lockZone(name)()
 
 	dnsClient, err := p.initClient(ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	domainID, err := dnsClient.getDomainID(ctx, zone)
+	domainID, err := p.getDomainID(ctx, dnsClient, name)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	for _, rec := range records {
-		converted, err := convertToConohaDNSRecord(rec)
-		if err != nil {
-			return nil, err
-		}
-
-		recordID, err := dnsClient.getRecordID(ctx, domainID, converted.Name, converted.Type)
-		if err != nil {
-			return nil, err
-		}
-
-		if err := dnsClient.deleteRecord(ctx, domainID, recordID); err != nil {
-			return nil, err
-		}
+	if planner := dnsClient.plan(); planner != nil {
+		planner.add(ctx, PlannedChange{Action: "delete", Zone: name})
+		return nil
 	}
 
-	return records, nil
+	// Forget the ID whatever the outcome: it is either gone or no longer trusted.
+	p.forgetDomainID(name)
+
+	return dnsClient.deleteDomain(ctx, domainID)
 }
 
 // convertToLibdnsRecord converts a raw API record to a libdns-compatible record.
+// The server-assigned UUID is kept in the record's ProviderData as a RecordMetadata.
+// Errors wrap ErrUnsupportedType or ErrRecordParse.
 func convertToLibdnsRecord(rec conohaDNSRecord) (libdns.Record, error) {
+	libRecord, err := newLibdnsRecord(rec, recordProviderData(rec))
+	if err != nil && !errors.Is(err, ErrUnsupportedType) {
+		return nil, fmt.Errorf("%w: %w", ErrRecordParse, err)
+	}
+	return libRecord, err
+}
+
+// convertToLibdnsRecordOrRR is like convertToLibdnsRecord, but returns
+// records that can't be converted as a plain libdns.RR.
+func convertToLibdnsRecordOrRR(rec conohaDNSRecord) libdns.Record {
+	libRecord, err := convertToLibdnsRecord(rec)
+	if err != nil {
+		return libdns.RR{Name: rec.Name, Type: rec.Type, Data: rec.Data, TTL: time.Duration(rec.TTL) * time.Second}
+	}
+	return libRecord
+}
+
+// newLibdnsRecord converts a raw API record to a libdns record carrying providerData.
+func newLibdnsRecord(rec conohaDNSRecord, providerData any) (libdns.Record, error) {
 	ttl := time.Duration(rec.TTL) * time.Second
 
 	switch rec.Type {
@@ -192,37 +1671,250 @@ func convertToLibdnsRecord(rec conohaDNSRecord) (libdns.Record, error) {
 			return nil, err
 		}
 		return libdns.Address{
-			Name: rec.Name,
-			TTL:  ttl,
-			IP:   ip,
+			Name:         rec.Name,
+			TTL:          ttl,
+			IP:           ip,
+			ProviderData: providerData,
 		}, nil
 	case "CNAME":
 		return libdns.CNAME{
-			Name:   rec.Name,
-			TTL:    ttl,
-			Target: rec.Data,
+			Name:         rec.Name,
+			TTL:          ttl,
+			Target:       rec.Data,
+			ProviderData: providerData,
 		}, nil
 	case "TXT":
 		return libdns.TXT{
-			Name: rec.Name,
-			TTL:  ttl,
-			Text: rec.Data,
+			Name:         rec.Name,
+			TTL:          ttl,
+			Text:         parseTXTData(rec.Data),
+			ProviderData: providerData,
+		}, nil
+	case "MX":
+		fields := strings.Fields(rec.Data)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("malformed MX data %q: expected \"<preference> <target>\"", rec.Data)
+		}
+		preference, err := strconv.ParseUint(fields[0], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("malformed MX data %q: invalid preference: %w", rec.Data, err)
+		}
+		return libdns.MX{
+			Name:         rec.Name,
+			TTL:          ttl,
+			Preference:   uint16(preference),
+			Target:       fields[1],
+			ProviderData: providerData,
+		}, nil
+	case "SRV":
+		fields := strings.Fields(rec.Data)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("malformed SRV data %q: expected \"<priority> <weight> <port> <target>\"", rec.Data)
+		}
+		values := make([]uint16, 3)
+		for i, field := range fields[:3] {
+			v, err := strconv.ParseUint(field, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("malformed SRV data %q: %w", rec.Data, err)
+			}
+			values[i] = uint16(v)
+		}
+		labels := strings.SplitN(rec.Name, ".", 3)
+		if len(labels) < 3 || !strings.HasPrefix(labels[0], "_") || !strings.HasPrefix(labels[1], "_") {
+			return nil, fmt.Errorf("malformed SRV name %q: expected \"_service._proto.name\"", rec.Name)
+		}
+		return libdns.SRV{
+			Service:      strings.TrimPrefix(labels[0], "_"),
+			Transport:    strings.TrimPrefix(labels[1], "_"),
+			Name:         labels[2],
+			TTL:          ttl,
+			Priority:     values[0],
+			Weight:       values[1],
+			Port:         values[2],
+			Target:       fields[3],
+			ProviderData: providerData,
+		}, nil
+	case "NS":
+		// This also covers the apex NS records that ConoHa manages for every zone.
+		return libdns.NS{
+			Name:         rec.Name,
+			TTL:          ttl,
+			Target:       rec.Data,
+			ProviderData: providerData,
+		}, nil
+	case "SOA":
+		fields := strings.Fields(rec.Data)
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("malformed SOA data %q: expected \"<mname> <rname> <serial> <refresh> <retry> <expire> <minimum>\"", rec.Data)
+		}
+		values := make([]uint32, 5)
+		for i, field := range fields[2:] {
+			v, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("malformed SOA data %q: %w", rec.Data, err)
+			}
+			values[i] = uint32(v)
+		}
+		return SOA{
+			Name:         rec.Name,
+			TTL:          ttl,
+			MName:        fields[0],
+			RName:        fields[1],
+			Serial:       values[0],
+			Refresh:      time.Duration(values[1]) * time.Second,
+			Retry:        time.Duration(values[2]) * time.Second,
+			Expire:       time.Duration(values[3]) * time.Second,
+			Minimum:      time.Duration(values[4]) * time.Second,
+			ProviderData: providerData,
+		}, nil
+	case "ALIAS":
+		return ALIAS{
+			Name:         rec.Name,
+			TTL:          ttl,
+			Target:       rec.Data,
+			ProviderData: providerData,
+		}, nil
+	case "DS":
+		fields := strings.Fields(rec.Data)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("malformed DS data %q: expected \"<key tag> <algorithm> <digest type> <digest>\"", rec.Data)
+		}
+		keyTag, err := strconv.ParseUint(fields[0], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("malformed DS data %q: invalid key tag: %w", rec.Data, err)
+		}
+		algorithm, err := strconv.ParseUint(fields[1], 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("malformed DS data %q: invalid algorithm: %w", rec.Data, err)
+		}
+		digestType, err := strconv.ParseUint(fields[2], 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("malformed DS data %q: invalid digest type: %w", rec.Data, err)
+		}
+		if _, err := hex.DecodeString(fields[3]); err != nil {
+			return nil, fmt.Errorf("malformed DS data %q: invalid digest: %w", rec.Data, err)
+		}
+		return DS{
+			Name:         rec.Name,
+			TTL:          ttl,
+			KeyTag:       uint16(keyTag),
+			Algorithm:    uint8(algorithm),
+			DigestType:   uint8(digestType),
+			Digest:       fields[3],
+			ProviderData: providerData,
 		}, nil
+	case "TLSA":
+		fields := strings.Fields(rec.Data)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("malformed TLSA data %q: expected \"<usage> <selector> <matching type> <certificate data>\"", rec.Data)
+		}
+		values := make([]uint8, 3)
+		for i, field := range fields[:3] {
+			v, err := strconv.ParseUint(field, 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("malformed TLSA data %q: %w", rec.Data, err)
+			}
+			values[i] = uint8(v)
+		}
+		if _, err := hex.DecodeString(fields[3]); err != nil {
+			return nil, fmt.Errorf("malformed TLSA data %q: invalid certificate data: %w", rec.Data, err)
+		}
+		labels := strings.SplitN(rec.Name, ".", 3)
+		if len(labels) < 3 || !strings.HasPrefix(labels[0], "_") || !strings.HasPrefix(labels[1], "_") {
+			return nil, fmt.Errorf("malformed TLSA name %q: expected \"_port._protocol.name\"", rec.Name)
+		}
+		port, err := strconv.ParseUint(strings.TrimPrefix(labels[0], "_"), 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("malformed TLSA name %q: invalid port: %w", rec.Name, err)
+		}
+		return TLSA{
+			Port:         uint16(port),
+			Protocol:     strings.ToLower(strings.TrimPrefix(labels[1], "_")),
+			Name:         labels[2],
+			TTL:          ttl,
+			Usage:        values[0],
+			Selector:     values[1],
+			MatchingType: values[2],
+			CertData:     fields[3],
+			ProviderData: providerData,
+		}, nil
+	case "SSHFP":
+		fields := strings.Fields(rec.Data)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("malformed SSHFP data %q: expected \"<algorithm> <fingerprint type> <fingerprint>\"", rec.Data)
+		}
+		algorithm, err := strconv.ParseUint(fields[0], 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("malformed SSHFP data %q: invalid algorithm: %w", rec.Data, err)
+		}
+		fingerprintType, err := strconv.ParseUint(fields[1], 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("malformed SSHFP data %q: invalid fingerprint type: %w", rec.Data, err)
+		}
+		if _, err := hex.DecodeString(fields[2]); err != nil {
+			return nil, fmt.Errorf("malformed SSHFP data %q: invalid fingerprint: %w", rec.Data, err)
+		}
+		return SSHFP{
+			Name:            rec.Name,
+			TTL:             ttl,
+			Algorithm:       uint8(algorithm),
+			FingerprintType: uint8(fingerprintType),
+			Fingerprint:     fields[2],
+			ProviderData:    providerData,
+		}, nil
+	case "NAPTR":
+		fields, ok := splitFields(rec.Data)
+		if !ok || len(fields) != 6 {
+			return nil, fmt.Errorf("malformed NAPTR data %q: expected \"<order> <preference> <flags> <service> <regexp> <replacement>\"", rec.Data)
+		}
+		order, err := strconv.ParseUint(fields[0], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("malformed NAPTR data %q: invalid order: %w", rec.Data, err)
+		}
+		preference, err := strconv.ParseUint(fields[1], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("malformed NAPTR data %q: invalid preference: %w", rec.Data, err)
+		}
+		return NAPTR{
+			Name:         rec.Name,
+			TTL:          ttl,
+			Order:        uint16(order),
+			Preference:   uint16(preference),
+			Flags:        fields[2],
+			Service:      fields[3],
+			Regexp:       fields[4],
+			Replacement:  fields[5],
+			ProviderData: providerData,
+		}, nil
+	case "SVCB", "HTTPS":
+		// libdns already knows how to split the name and the SvcParams of service bindings.
+		parsed, err := libdns.RR{Name: rec.Name, TTL: ttl, Type: rec.Type, Data: rec.Data}.Parse()
+		if err != nil {
+			return nil, fmt.Errorf("malformed %s record %q: %w", rec.Type, rec.Name, err)
+		}
+		svcb := parsed.(libdns.ServiceBinding)
+		svcb.ProviderData = providerData
+		return svcb, nil
 	default:
-		return nil, errRecordNotSupported
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, rec.Type)
 	}
 }
 
 // convertToConohaDNSRecord converts a libdns.Record into a ConoHa-compatible raw Record struct.
+// Errors wrap ErrNilRecord, ErrRecordParse or ErrUnsupportedType.
 func convertToConohaDNSRecord(rec libdns.Record) (conohaDNSRecord, error) {
+	if rec == nil {
+		return conohaDNSRecord{}, ErrNilRecord
+	}
+
 	rr := rec.RR()
 	parsed, err := rr.Parse()
 	if err != nil {
-		return conohaDNSRecord{}, fmt.Errorf("failed to parse record: %w", err)
+		return conohaDNSRecord{}, fmt.Errorf("%w: %w", ErrRecordParse, err)
 	}
 
 	if parsed == nil {
-		return conohaDNSRecord{}, fmt.Errorf("record is nil after parsing: %v", rec)
+		return conohaDNSRecord{}, fmt.Errorf("%w after parsing: %v", ErrNilRecord, rec)
 	}
 
 	switch r := parsed.(type) {
@@ -244,12 +1936,202 @@ func convertToConohaDNSRecord(rec libdns.Record) (conohaDNSRecord, error) {
 		return conohaDNSRecord{
 			Name: r.Name,
 			Type: rr.Type,
-			Data: r.Text,
+			Data: formatTXTData(r.Text),
+			TTL:  int(r.TTL.Seconds()),
+		}, nil
+	case libdns.MX:
+		return conohaDNSRecord{
+			Name: r.Name,
+			Type: rr.Type,
+			Data: fmt.Sprintf("%d %s", r.Preference, r.Target),
+			TTL:  int(r.TTL.Seconds()),
+		}, nil
+	case libdns.SRV:
+		// rr.Name already carries the "_service._proto." prefix.
+		return conohaDNSRecord{
+			Name: rr.Name,
+			Type: rr.Type,
+			Data: fmt.Sprintf("%d %d %d %s", r.Priority, r.Weight, r.Port, r.Target),
+			TTL:  int(r.TTL.Seconds()),
+		}, nil
+	case libdns.NS:
+		return conohaDNSRecord{
+			Name: r.Name,
+			Type: rr.Type,
+			Data: r.Target,
+			TTL:  int(r.TTL.Seconds()),
+		}, nil
+	case libdns.ServiceBinding:
+		// rr.Name already carries the "_port._scheme." prefix when needed.
+		return conohaDNSRecord{
+			Name: rr.Name,
+			Type: rr.Type,
+			Data: serviceBindingData(r),
+			TTL:  int(r.TTL.Seconds()),
+		}, nil
+	case libdns.RR:
+		// Types unknown to libdns, such as ALIAS, are left unparsed. Those modeled by this
+		// package are parsed with the reading converter to check and normalize their data.
+		if !writableProviderTypes[r.Type] {
+			return conohaDNSRecord{}, fmt.Errorf("%w: %s", ErrUnsupportedType, r.Type)
+		}
+		own, err := convertToLibdnsRecord(conohaDNSRecord{Name: r.Name, Type: r.Type, Data: r.Data})
+		if err != nil {
+			return conohaDNSRecord{}, err
+		}
+		ownRR := own.RR()
+		return conohaDNSRecord{
+			Name: ownRR.Name,
+			Type: ownRR.Type,
+			Data: ownRR.Data,
 			TTL:  int(r.TTL.Seconds()),
 		}, nil
 	default:
-		return conohaDNSRecord{}, errRecordNotSupported
+		return conohaDNSRecord{}, fmt.Errorf("%w: %s", ErrUnsupportedType, rr.Type)
+	}
+}
+
+// writableProviderTypes lists the record types modeled in records.go that can be written.
+var writableProviderTypes = map[string]bool{
+	"ALIAS": true,
+	"DS":    true,
+	"TLSA":  true,
+	"SSHFP": true,
+	"NAPTR": true,
+}
+
+// maxTXTStringLen is the maximum length of a single character-string in a TXT record (RFC 1035 §3.3).
+const maxTXTStringLen = 255
+
+// formatTXTData returns the data field for a TXT record holding text.
+// Text that fits in a single character-string is sent as is, unless parseTXTData would
+// mistake it for quoted data; longer text is split into quoted character-strings of at most 255 bytes each.
+func formatTXTData(text string) string {
+	if len(text) <= maxTXTStringLen {
+		if strings.HasPrefix(strings.TrimSpace(text), `"`) {
+			return quoteTXTString(text)
+		}
+		return text
+	}
+
+	var chunks []string
+	for len(text) > 0 {
+		n := len(text)
+		if n > maxTXTStringLen {
+			n = maxTXTStringLen
+		}
+		chunks = append(chunks, quoteTXTString(text[:n]))
+		text = text[n:]
+	}
+
+	return strings.Join(chunks, " ")
+}
+
+// quoteTXTString wraps s in double quotes, escaping quotes and backslashes.
+func quoteTXTString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// parseTXTData returns the text held by a TXT data field.
+// Data made of one or more quoted character-strings is unquoted and joined;
+// anything else is returned unchanged.
+func parseTXTData(data string) string {
+	var b strings.Builder
+	rest := strings.TrimSpace(data)
+	if !strings.HasPrefix(rest, `"`) {
+		return data
+	}
+
+	for rest != "" {
+		if rest[0] != '"' {
+			return data
+		}
+
+		closed := false
+		i := 1
+		for ; i < len(rest); i++ {
+			if rest[i] == '\\' && i+1 < len(rest) {
+				i++
+				b.WriteByte(rest[i])
+				continue
+			}
+			if rest[i] == '"' {
+				closed = true
+				break
+			}
+			b.WriteByte(rest[i])
+		}
+		if !closed {
+			return data
+		}
+
+		rest = strings.TrimLeft(rest[i+1:], " ")
+	}
+
+	return b.String()
+}
+
+// splitFields splits data into its space-separated fields, unquoting the quoted ones,
+// so that a quoted field may hold spaces or be empty. It reports false if a quote isn't closed.
+func splitFields(data string) ([]string, bool) {
+	var fields []string
+	rest := strings.TrimSpace(data)
+	for rest != "" {
+		if rest[0] != '"' {
+			end := strings.IndexAny(rest, " \t")
+			if end < 0 {
+				end = len(rest)
+			}
+			fields = append(fields, rest[:end])
+			rest = strings.TrimSpace(rest[end:])
+			continue
+		}
+
+		var b strings.Builder
+		closed := false
+		i := 1
+		for ; i < len(rest); i++ {
+			if rest[i] == '\\' && i+1 < len(rest) {
+				i++
+				b.WriteByte(rest[i])
+				continue
+			}
+			if rest[i] == '"' {
+				closed = true
+				break
+			}
+			b.WriteByte(rest[i])
+		}
+		if !closed {
+			return nil, false
+		}
+		fields = append(fields, b.String())
+		rest = strings.TrimSpace(rest[i+1:])
 	}
+	return fields, true
+}
+
+// serviceBindingData formats the RDATA of a SVCB/HTTPS record.
+// Unlike libdns.SvcParams.String, the parameters are sorted by key so the result is stable.
+func serviceBindingData(r libdns.ServiceBinding) string {
+	fields := []string{strconv.Itoa(int(r.Priority)), r.Target}
+
+	// SvcParams must be empty in alias mode (priority 0).
+	if r.Priority != 0 {
+		keys := make([]string, 0, len(r.Params))
+		for key := range r.Params {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			fields = append(fields, libdns.SvcParams{key: r.Params[key]}.String())
+		}
+	}
+
+	return strings.Join(fields, " ")
 }
 
 // Interface guards
@@ -258,4 +2140,5 @@ var (
 	_ libdns.RecordAppender = (*Provider)(nil)
 	_ libdns.RecordSetter   = (*Provider)(nil)
 	_ libdns.RecordDeleter  = (*Provider)(nil)
+	_ libdns.ZoneLister     = (*Provider)(nil)
 )
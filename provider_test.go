@@ -1,9 +1,21 @@
 package conohav3
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
 	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -53,15 +65,12 @@ func cleanupRecords(t *testing.T, p *Provider, records []libdns.Record) {
 }
 
 func isSameRecord(a libdns.Record, b libdns.Record) bool {
-	rawa, _ := convertToConohaDNSRecord(a)
-	rawb, _ := convertToConohaDNSRecord(b)
-
 	// NOTE: We intentionally do not compare TTL values here.
 	// ConoHa's API does not consistently preserve or allow updates to TTL,
 	// especially during record updates, where TTL may be omitted or reset.
 	// Comparing TTL would cause false mismatches in those cases.
 
-	return rawa.Name == rawb.Name && rawa.Type == rawb.Type && rawa.Data == rawb.Data
+	return RecordsEqual(a, b, false)
 }
 
 func TestProvider_GetRecords(t *testing.T) {
@@ -151,3 +160,2482 @@ func TestProvider_SetProvider(t *testing.T) {
 		}
 	}
 }
+
+func TestConvertMXRecord(t *testing.T) {
+	rec := libdns.MX{
+		Name:       "example.com.",
+		TTL:        time.Duration(3600) * time.Second,
+		Preference: 10,
+		Target:     "mail.example.com.",
+	}
+
+	raw, err := convertToConohaDNSRecord(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw.Data != "10 mail.example.com." {
+		t.Fatalf("unexpected data: %q", raw.Data)
+	}
+
+	converted, err := convertToLibdnsRecord(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mx, ok := converted.(libdns.MX)
+	if !ok {
+		t.Fatalf("expected libdns.MX, got %T", converted)
+	}
+	if mx.Preference != rec.Preference || mx.Target != rec.Target || mx.TTL != rec.TTL {
+		t.Fatalf("round trip mismatch: %+v", mx)
+	}
+
+	if _, err := convertToLibdnsRecord(conohaDNSRecord{Name: "example.com.", Type: "MX", Data: "mail.example.com."}); err == nil {
+		t.Fatal("expected error for MX data without preference")
+	}
+}
+
+func TestConvertSRVRecord(t *testing.T) {
+	rec := libdns.SRV{
+		Service:   "sip",
+		Transport: "tcp",
+		Name:      "example.com.",
+		TTL:       time.Duration(3600) * time.Second,
+		Priority:  10,
+		Weight:    20,
+		Port:      5060,
+		Target:    "sip.example.com.",
+	}
+
+	raw, err := convertToConohaDNSRecord(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw.Name != "_sip._tcp.example.com." || raw.Data != "10 20 5060 sip.example.com." {
+		t.Fatalf("unexpected raw record: %+v", raw)
+	}
+
+	converted, err := convertToLibdnsRecord(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, ok := converted.(libdns.SRV)
+	if !ok {
+		t.Fatalf("expected libdns.SRV, got %T", converted)
+	}
+	if srv != rec {
+		t.Fatalf("round trip mismatch: got %+v, want %+v", srv, rec)
+	}
+}
+
+func TestConvertNSRecord(t *testing.T) {
+	raw := conohaDNSRecord{UUID: "record-ns", Name: "example.com.", Type: "NS", Data: "ns-a1.conoha.io.", TTL: 3600}
+
+	converted, err := convertToLibdnsRecord(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns, ok := converted.(libdns.NS)
+	if !ok {
+		t.Fatalf("expected libdns.NS, got %T", converted)
+	}
+	if ns.Name != raw.Name || ns.Target != raw.Data || ns.TTL != time.Hour {
+		t.Fatalf("unexpected record: %+v", ns)
+	}
+
+	back, err := convertToConohaDNSRecord(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.Name != raw.Name || back.Type != raw.Type || back.Data != raw.Data || back.TTL != raw.TTL {
+		t.Fatalf("round trip mismatch: got %+v, want %+v", back, raw)
+	}
+}
+
+func TestProvider_AppendRecordsReturnsUUID(t *testing.T) {
+	p, _ := newTestProvider(t, "example.com.")
+
+	created, err := p.AppendRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.TXT{Name: "test.example.com.", Text: "value", TTL: 600 * time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(created))
+	}
+
+	txt, ok := created[0].(libdns.TXT)
+	if !ok {
+		t.Fatalf("expected libdns.TXT, got %T", created[0])
+	}
+	metadata, ok := txt.ProviderData.(RecordMetadata)
+	if !ok || metadata.UUID == "" {
+		t.Fatalf("expected RecordMetadata with UUID, got %#v", txt.ProviderData)
+	}
+	if txt.Text != "value" || txt.TTL != 600*time.Second {
+		t.Fatalf("unexpected record: %+v", txt)
+	}
+}
+
+func TestProvider_SetRecordsSkipsUnchanged(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "test.example.com.", Type: "TXT", Data: "value"})
+
+	records := []libdns.Record{libdns.TXT{Name: "test.example.com.", Text: "value"}}
+	if _, err := p.SetRecords(context.TODO(), "example.com.", records); err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.countRequests(http.MethodPut, "/v1/"); n != 0 {
+		t.Fatalf("expected no update, got %d", n)
+	}
+
+	records = []libdns.Record{libdns.TXT{Name: "test.example.com.", Text: "updated"}}
+	if _, err := p.SetRecords(context.TODO(), "example.com.", records); err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.countRequests(http.MethodPut, "/v1/"); n != 1 {
+		t.Fatalf("expected 1 update, got %d", n)
+	}
+}
+
+func TestProvider_SetRecordsReplacesRRSet(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "_acme-challenge.example.com.", Type: "TXT", Data: "stale1"})
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "_acme-challenge.example.com.", Type: "TXT", Data: "keep"})
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "_acme-challenge.example.com.", Type: "TXT", Data: "stale2"})
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "other.example.com.", Type: "TXT", Data: "untouched"})
+
+	_, err := p.SetRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.TXT{Name: "_acme-challenge.example.com.", Text: "keep"},
+		libdns.TXT{Name: "_acme-challenge.example.com.", Text: "new"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]bool{}
+	for _, rec := range fake.records["domain-id"] {
+		got[rec.Name+" "+rec.Data] = true
+	}
+	want := map[string]bool{
+		"_acme-challenge.example.com. keep": true,
+		"_acme-challenge.example.com. new":  true,
+		"other.example.com. untouched":      true,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected records: %v", got)
+	}
+	for key := range want {
+		if !got[key] {
+			t.Fatalf("missing record %q in %v", key, got)
+		}
+	}
+}
+
+func TestProvider_SetRecordsReconcilesRRSet(t *testing.T) {
+	tests := []struct {
+		name                   string
+		have, want             []string
+		creates, updates, dels int
+	}{
+		{name: "create into empty rrset", want: []string{"a", "b"}, creates: 2},
+		{name: "unchanged", have: []string{"a", "b"}, want: []string{"b", "a"}},
+		{name: "update in place", have: []string{"a"}, want: []string{"b"}, updates: 1},
+		{name: "delete extra", have: []string{"a", "b", "c"}, want: []string{"b"}, dels: 2},
+		{name: "update and create", have: []string{"a"}, want: []string{"b", "c"}, updates: 1, creates: 1},
+		{name: "update and delete", have: []string{"a", "b", "c"}, want: []string{"a", "d"}, updates: 1, dels: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, fake := newTestProvider(t, "example.com.")
+			for _, data := range tt.have {
+				fake.addRecord("domain-id", conohaDNSRecord{Name: "test.example.com.", Type: "TXT", Data: data})
+			}
+			fake.addRecord("domain-id", conohaDNSRecord{Name: "test.example.com.", Type: "A", Data: "192.0.2.1"})
+
+			var records []libdns.Record
+			for _, data := range tt.want {
+				records = append(records, libdns.TXT{Name: "test.example.com.", Text: data})
+			}
+			if _, err := p.SetRecords(context.TODO(), "example.com.", records); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, rec := range fake.records["domain-id"] {
+				if rec.Type == "TXT" {
+					got = append(got, rec.Data)
+				}
+			}
+			sort.Strings(got)
+			want := append([]string(nil), tt.want...)
+			sort.Strings(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("unexpected rrset: got %q, want %q", got, want)
+			}
+			if len(fake.records["domain-id"]) != len(want)+1 {
+				t.Fatalf("expected the A record to be left alone, got %+v", fake.records["domain-id"])
+			}
+
+			path := "/v1/domains/domain-id/records"
+			if n := fake.countRequests(http.MethodPost, path); n != tt.creates {
+				t.Errorf("expected %d creations, got %d", tt.creates, n)
+			}
+			if n := fake.countRequests(http.MethodPut, path); n != tt.updates {
+				t.Errorf("expected %d updates, got %d", tt.updates, n)
+			}
+			if n := fake.countRequests(http.MethodDelete, path); n != tt.dels {
+				t.Errorf("expected %d deletions, got %d", tt.dels, n)
+			}
+		})
+	}
+}
+
+func TestProvider_SetRecordsSkipsTTLOnlyChanges(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "test.example.com.", Type: "TXT", Data: "value", TTL: 3600})
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "www.example.com.", Type: "A", Data: "192.0.2.1", TTL: 3600})
+
+	set, err := p.SetRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.TXT{Name: "test.example.com.", Text: "value", TTL: 300 * time.Second},
+		libdns.Address{Name: "WWW.example.com.", IP: netip.MustParseAddr("192.0.2.1"), TTL: 600 * time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set) != 2 {
+		t.Fatalf("expected both records to be returned, got %+v", set)
+	}
+
+	path := "/v1/domains/domain-id/records"
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodDelete} {
+		if n := fake.countRequests(method, path); n != 0 {
+			t.Errorf("expected no %s request, got %d", method, n)
+		}
+	}
+}
+
+func TestProvider_AppendRecordsReportsPartialFailure(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+
+	created, err := p.AppendRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.TXT{Name: "first.example.com.", Text: "value"},
+		libdns.RR{Name: "bad.example.com.", Type: "UNKNOWN", Data: "value"},
+		libdns.TXT{Name: "second.example.com.", Text: "value"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "bad.example.com.") {
+		t.Fatalf("expected an error naming the failing record, got %v", err)
+	}
+	if len(created) != 2 {
+		t.Fatalf("expected 2 created records, got %d", len(created))
+	}
+	if len(fake.records["domain-id"]) != 2 {
+		t.Fatalf("expected 2 stored records, got %d", len(fake.records["domain-id"]))
+	}
+}
+
+func TestConvertHTTPSRecord(t *testing.T) {
+	rec := libdns.ServiceBinding{
+		Scheme:   "https",
+		Name:     "example.com.",
+		TTL:      time.Duration(3600) * time.Second,
+		Priority: 1,
+		Target:   ".",
+		Params: libdns.SvcParams{
+			"alpn":     {"h2", "h3"},
+			"ipv4hint": {"192.0.2.1", "192.0.2.2"},
+		},
+	}
+
+	raw, err := convertToConohaDNSRecord(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw.Type != "HTTPS" || raw.Name != "example.com." || raw.Data != "1 . alpn=h2,h3 ipv4hint=192.0.2.1,192.0.2.2" {
+		t.Fatalf("unexpected raw record: %+v", raw)
+	}
+
+	converted, err := convertToLibdnsRecord(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svcb, ok := converted.(libdns.ServiceBinding)
+	if !ok {
+		t.Fatalf("expected libdns.ServiceBinding, got %T", converted)
+	}
+	if svcb.Scheme != rec.Scheme || svcb.Name != rec.Name || svcb.Priority != rec.Priority || svcb.Target != rec.Target {
+		t.Fatalf("round trip mismatch: %+v", svcb)
+	}
+	if !reflect.DeepEqual(svcb.Params, rec.Params) {
+		t.Fatalf("unexpected params: %v", svcb.Params)
+	}
+}
+
+func TestConvertSVCBRecord(t *testing.T) {
+	raw := conohaDNSRecord{Name: "_dns.example.com.", Type: "SVCB", Data: "1 dns.example.com. alpn=dot port=853"}
+
+	converted, err := convertToLibdnsRecord(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svcb, ok := converted.(libdns.ServiceBinding)
+	if !ok {
+		t.Fatalf("expected libdns.ServiceBinding, got %T", converted)
+	}
+	if svcb.Scheme != "dns" || svcb.Name != "example.com." {
+		t.Fatalf("unexpected record: %+v", svcb)
+	}
+
+	back, err := convertToConohaDNSRecord(svcb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.Name != raw.Name || back.Type != raw.Type || back.Data != raw.Data {
+		t.Fatalf("round trip mismatch: got %+v, want %+v", back, raw)
+	}
+}
+
+func TestConvertLongTXTRecord(t *testing.T) {
+	text := strings.Repeat("a", 300) + `"quoted" \ ` + strings.Repeat("b", 300)
+	rec := libdns.TXT{Name: "dkim._domainkey.example.com.", Text: text}
+
+	raw, err := convertToConohaDNSRecord(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(raw.Data, `"`+strings.Repeat("a", 255)+`" "`) {
+		t.Fatalf("expected data to be split into quoted strings, got %q", raw.Data)
+	}
+
+	converted, err := convertToLibdnsRecord(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txt := converted.(libdns.TXT); txt.Text != text {
+		t.Fatalf("round trip mismatch: got %q", txt.Text)
+	}
+
+	short, err := convertToConohaDNSRecord(libdns.TXT{Name: "test.example.com.", Text: "v=spf1 -all"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if short.Data != "v=spf1 -all" {
+		t.Fatalf("expected short text to be sent as is, got %q", short.Data)
+	}
+}
+
+func TestProvider_SetRecordsPreserveTTLOnUpdate(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	p.PreserveTTLOnUpdate = true
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "test.example.com.", Type: "TXT", Data: "value", TTL: 3600})
+
+	_, err := p.SetRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.TXT{Name: "test.example.com.", Text: "value", TTL: 300 * time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := fake.records["domain-id"]
+	if len(records) != 1 || records[0].TTL != 300 || records[0].Data != "value" {
+		t.Fatalf("expected the record to be recreated with the new TTL, got %+v", records)
+	}
+	if n := fake.countRequests(http.MethodPut, "/v1/"); n != 0 {
+		t.Fatalf("expected no update, got %d", n)
+	}
+}
+
+func TestProvider_SetRecordsPreserveTTLCreatesFirst(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	p.PreserveTTLOnUpdate = true
+	old := fake.addRecord("domain-id", conohaDNSRecord{Name: "test.example.com.", Type: "TXT", Data: "old", TTL: 3600})
+
+	if _, err := p.SetRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.TXT{Name: "test.example.com.", Text: "new", TTL: 300 * time.Second},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	records := fake.records["domain-id"]
+	if len(records) != 1 || records[0].TTL != 300 || records[0].Data != "new" {
+		t.Fatalf("expected the record to be replaced, got %+v", records)
+	}
+	var writes []string
+	for _, r := range fake.requests {
+		if !strings.HasPrefix(r, http.MethodGet) && !strings.HasPrefix(r, http.MethodPost+" /v3/") {
+			writes = append(writes, r)
+		}
+	}
+	want := []string{"POST /v1/domains/domain-id/records", "DELETE /v1/domains/domain-id/records/" + old.UUID}
+	if !reflect.DeepEqual(writes, want) {
+		t.Fatalf("expected the new record to be created before the old one is deleted, got %v", writes)
+	}
+}
+
+func TestProvider_SetRecordsPreserveTTLRestoresRecord(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	p.PreserveTTLOnUpdate = true
+	old := fake.addRecord("domain-id", conohaDNSRecord{Name: "test.example.com.", Type: "TXT", Data: "value", TTL: 3600})
+
+	// ConoHa rejects the duplicate of the old record, then fails the creation with the new TTL.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fake.mu.Lock()
+		empty := len(fake.records["domain-id"]) == 0
+		fake.mu.Unlock()
+		if r.Method == http.MethodPost && r.URL.Path == "/v1/domains/domain-id/records" && empty {
+			body, _ := io.ReadAll(r.Body)
+			if strings.Contains(string(body), `"ttl":300`) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	p.IdentityEndpoint, p.DNSEndpoint = server.URL, server.URL
+	p.HTTPClient = nil
+
+	_, err := p.SetRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.TXT{Name: "test.example.com.", Text: "value", TTL: 300 * time.Second},
+	})
+	if err == nil || !strings.Contains(err.Error(), old.UUID) {
+		t.Fatalf("expected an error naming the deleted record, got %v", err)
+	}
+
+	records := fake.records["domain-id"]
+	if len(records) != 1 || records[0].TTL != 3600 || records[0].Data != "value" {
+		t.Fatalf("expected the old record to be restored, got %+v", records)
+	}
+}
+
+func TestProvider_UnknownRegion(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	p.Region = "c3jj1"
+
+	_, err := p.GetRecords(context.TODO(), "example.com.")
+	if err == nil || !strings.Contains(err.Error(), `unknown region "c3jj1"`) {
+		t.Fatalf("expected an unknown region error, got %v", err)
+	}
+	if len(fake.requests) != 0 {
+		t.Fatalf("expected no request, got %v", fake.requests)
+	}
+}
+
+func TestProvider_EndpointOverrides(t *testing.T) {
+	_, fake := newTestProvider(t, "example.com.")
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "test.example.com.", Type: "TXT", Data: "value"})
+
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	p := &Provider{
+		APITenantID:      "tenant",
+		APIUserID:        "user",
+		APIPassword:      "password",
+		IdentityEndpoint: server.URL,
+		DNSEndpoint:      server.URL,
+	}
+
+	records, err := p.GetRecords(context.TODO(), "example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(records))
+	}
+}
+
+func TestProvider_AppendRecordsRetriesAfterBadGateway(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	p.RetryBaseDelay = time.Millisecond
+
+	// The first creation fails before reaching ConoHa.
+	failed := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/v1/domains/domain-id/records" && !failed {
+			failed = true
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	p.IdentityEndpoint, p.DNSEndpoint = server.URL, server.URL
+	p.HTTPClient = nil
+
+	created, err := p.AppendRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.TXT{Name: "_acme-challenge", Text: "token"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 1 || recordMetadata(created[0]).AlreadyPresent {
+		t.Fatalf("expected the record to be created, got %+v", created)
+	}
+	if records := fake.records["domain-id"]; len(records) != 1 {
+		t.Fatalf("expected a single record, got %+v", records)
+	}
+}
+
+func TestProvider_AppendRecordsNotRetriedAfterCommit(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+
+	// The record is stored, but a gateway in front of the API fails the response.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/domains/domain-id/records" {
+			fake.ServeHTTP(w, r)
+			return
+		}
+		fake.ServeHTTP(httptest.NewRecorder(), r)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+	p.IdentityEndpoint, p.DNSEndpoint = server.URL, server.URL
+	p.HTTPClient = nil
+
+	created, err := p.AppendRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.TXT{Name: "_acme-challenge", Text: "token"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 1 || recordMetadata(created[0]).UUID != fake.records["domain-id"][0].UUID {
+		t.Fatalf("expected the stored record to be returned, got %+v", created)
+	}
+	if n := fake.countRequests(http.MethodPost, "/v1/domains/domain-id/records"); n != 1 {
+		t.Fatalf("expected a single creation attempt, got %d", n)
+	}
+	if records := fake.records["domain-id"]; len(records) != 1 {
+		t.Fatalf("expected a single record, got %+v", records)
+	}
+}
+
+func TestProvider_CachesDomainID(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+
+	for i := 0; i < 2; i++ {
+		if _, err := p.GetRecords(context.TODO(), "example.com."); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := fake.countRequests(http.MethodGet, "/v1/domains"); n != 3 {
+		t.Fatalf("expected 1 domain lookup and 2 record listings, got %d requests", n)
+	}
+
+	// Recreate the zone under a new UUID: the stale ID yields a 404 and must be forgotten.
+	fake.mu.Lock()
+	fake.domains = []domain{{UUID: "new-domain-id", Name: "example.com."}}
+	fake.mu.Unlock()
+
+	if _, err := p.GetRecords(context.TODO(), "example.com."); !errors.Is(err, ErrZoneNotFound) {
+		t.Fatalf("expected ErrZoneNotFound for the stale zone ID, got %v", err)
+	}
+	if _, err := p.GetRecords(context.TODO(), "example.com."); err != nil {
+		t.Fatalf("expected the zone to be looked up again, got %v", err)
+	}
+}
+
+func TestProvider_CachesDomainIDCaseInsensitively(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+
+	for _, zone := range []string{"Example.COM.", "example.com."} {
+		if _, err := p.GetRecords(context.TODO(), zone); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := fake.countRequests(http.MethodGet, "/v1/domains"); n != 3 {
+		t.Fatalf("expected 1 domain lookup and 2 record listings, got %d requests", n)
+	}
+}
+
+func TestProvider_CreateZone(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+
+	zone, err := p.CreateZone(context.TODO(), "new.example.", "admin@new.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zone.Name != "new.example." || zone.UUID == "" || zone.UUID != fake.domains[len(fake.domains)-1].UUID {
+		t.Fatalf("expected the name and UUID of the new zone, got %+v", zone)
+	}
+
+	// The new zone's ID is cached, so adding a record needs no domain lookup.
+	if _, err := p.AppendRecords(context.TODO(), "new.example.", []libdns.Record{
+		libdns.TXT{Name: "test.new.example.", Text: "value"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.countRequests(http.MethodGet, "/v1/domains") - fake.countRequests(http.MethodGet, "/v1/domains/"); n != 0 {
+		t.Fatalf("expected no domain lookup, got %d", n)
+	}
+}
+
+func TestProvider_ListZonesMatching(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	for i, name := range []string{"sub.example.com.", "Deep.Sub.Example.com.", "notexample.com.", "example.net."} {
+		fake.domains = append(fake.domains, domain{UUID: fmt.Sprintf("domain-%d", i), Name: name})
+	}
+
+	tests := []struct {
+		suffix string
+		want   []string
+	}{
+		{suffix: "example.com.", want: []string{"example.com.", "sub.example.com.", "Deep.Sub.Example.com."}},
+		{suffix: "SUB.example.com", want: []string{"sub.example.com.", "Deep.Sub.Example.com."}},
+		{suffix: "org.", want: nil},
+		{suffix: "", want: []string{"example.com.", "sub.example.com.", "Deep.Sub.Example.com.", "notexample.com.", "example.net."}},
+	}
+
+	for _, tt := range tests {
+		zones, err := p.ListZonesMatching(context.TODO(), tt.suffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, zone := range zones {
+			got = append(got, zone.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("zones matching %q: got %q, want %q", tt.suffix, got, tt.want)
+		}
+	}
+}
+
+func TestProvider_CreateZoneEmail(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+
+	for _, email := range []string{"", "not-an-email", "Admin <admin@new.example>"} {
+		if _, err := p.CreateZone(context.TODO(), "new.example.", email); err == nil {
+			t.Fatalf("expected an error for email %q", email)
+		}
+	}
+	if n := fake.countRequests(http.MethodPost, "/v1/domains"); n != 0 {
+		t.Fatalf("expected no request for invalid emails, got %d", n)
+	}
+
+	p.DefaultZoneEmail = "hostmaster@example.com"
+	if _, err := p.CreateZone(context.TODO(), "new.example.", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.domains[len(fake.domains)-1].Email; got != "hostmaster@example.com" {
+		t.Fatalf("expected DefaultZoneEmail to be used, got %q", got)
+	}
+}
+
+func TestProvider_DeleteZone(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+
+	if err := p.DeleteZone(context.TODO(), "example.com."); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.domains) != 0 {
+		t.Fatalf("expected the zone to be deleted, got %+v", fake.domains)
+	}
+
+	err := p.DeleteZone(context.TODO(), "example.com.")
+	if !errors.Is(err, ErrZoneNotFound) {
+		t.Fatalf("expected ErrZoneNotFound, got %v", err)
+	}
+}
+
+func TestProvider_UpdateZoneSOA(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	fake.domains[0].Email = "old@example.com"
+	fake.domains[0].TTL = 3600
+
+	updated, err := p.UpdateZoneSOA(context.TODO(), "example.com.", ZoneSOA{Email: "hostmaster@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (ZoneSOA{Email: "hostmaster@example.com", TTL: time.Hour}); updated != want {
+		t.Fatalf("unexpected SOA: got %+v, want %+v", updated, want)
+	}
+
+	if _, err := p.UpdateZoneSOA(context.TODO(), "example.com.", ZoneSOA{TTL: time.Second}); err == nil {
+		t.Fatal("expected an error for a TTL below ConoHa's minimum")
+	}
+	if got := fake.countRequests(http.MethodPut, "/v1/domains/"); got != 1 {
+		t.Fatalf("expected 1 update request, got %d", got)
+	}
+}
+
+func TestProvider_DefaultTTL(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	p.DefaultTTL = 600 * time.Second
+
+	_, err := p.AppendRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.TXT{Name: "default.example.com.", Text: "value"},
+		libdns.TXT{Name: "explicit.example.com.", Text: "value", TTL: 1200 * time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rec := range fake.records["domain-id"] {
+		want := 600
+		if rec.Name == "explicit.example.com." {
+			want = 1200
+		}
+		if rec.TTL != want {
+			t.Fatalf("unexpected TTL for %s: got %d, want %d", rec.Name, rec.TTL, want)
+		}
+	}
+}
+
+func TestProvider_MinTTLPatterns(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	p.DefaultTTL = 600 * time.Second
+	p.MinTTLPatterns = []string{"_acme-challenge", "_dnsauth*"}
+
+	_, err := p.AppendRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.TXT{Name: "_acme-challenge.www.example.com.", Text: "value"},
+		libdns.TXT{Name: "_ACME-Challenge.example.com.", Text: "value"},
+		libdns.TXT{Name: "_dnsauth-1.example.com.", Text: "value"},
+		libdns.TXT{Name: "_acme-challenge.example.com.", Text: "explicit", TTL: 300 * time.Second},
+		libdns.TXT{Name: "_acme-challenge.example.com.", Text: "short", TTL: 30 * time.Second},
+		libdns.TXT{Name: "www._acme-challenge.example.com.", Text: "value"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int{minTTL, minTTL, minTTL, 300, minTTL, 600}
+	for i, rec := range fake.records["domain-id"] {
+		if rec.TTL != want[i] {
+			t.Fatalf("unexpected TTL for %s: got %d, want %d", rec.Name, rec.TTL, want[i])
+		}
+	}
+
+	// Other records below the minimum are still rejected.
+	if _, err := p.AppendRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.TXT{Name: "www.example.com.", Text: "value", TTL: 30 * time.Second},
+	}); !errors.Is(err, ErrInvalidRecord) {
+		t.Fatalf("expected ErrInvalidRecord, got %v", err)
+	}
+
+	p.MinTTLPatterns = []string{"[acme"}
+	if err := p.Validate(); err == nil {
+		t.Fatal("expected an error for a malformed pattern")
+	}
+}
+
+func TestConvertSOARecord(t *testing.T) {
+	raw := conohaDNSRecord{
+		Name: "example.com.",
+		Type: "SOA",
+		Data: "a.conoha-dns.com. postmaster.example.com. 2024010101 3600 900 1209600 300",
+		TTL:  3600,
+	}
+
+	converted, err := convertToLibdnsRecord(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	soa, ok := converted.(SOA)
+	if !ok {
+		t.Fatalf("expected SOA, got %T", converted)
+	}
+	if soa.Serial != 2024010101 || soa.Refresh != time.Hour || soa.Minimum != 5*time.Minute {
+		t.Fatalf("unexpected record: %+v", soa)
+	}
+	if soa.RR().Data != raw.Data {
+		t.Fatalf("unexpected data: %q", soa.RR().Data)
+	}
+
+	if _, err := convertToConohaDNSRecord(soa); err == nil {
+		t.Fatal("expected writing SOA records to be unsupported")
+	}
+}
+
+func TestProvider_AppendRecordsConcurrently(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	p.Concurrency = 4
+
+	var records []libdns.Record
+	for i := 0; i < 20; i++ {
+		records = append(records, libdns.TXT{Name: fmt.Sprintf("test%d.example.com.", i), Text: "value"})
+	}
+
+	created, err := p.AppendRecords(context.TODO(), "example.com.", records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != len(records) || len(fake.records["domain-id"]) != len(records) {
+		t.Fatalf("expected %d records, got %d returned and %d stored", len(records), len(created), len(fake.records["domain-id"]))
+	}
+	for i, rec := range created {
+		if rec.RR().Name != records[i].RR().Name {
+			t.Fatalf("expected results in input order, got %s at %d", rec.RR().Name, i)
+		}
+	}
+}
+
+func TestProvider_AppendRecordsSkipsExisting(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	old := fake.addRecord("domain-id", conohaDNSRecord{Name: "_acme-challenge.example.com.", Type: "TXT", Data: "token"})
+
+	records, err := p.AppendRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.TXT{Name: "_acme-challenge.example.com.", Text: "token"},
+		libdns.TXT{Name: "_acme-challenge.example.com.", Text: "other"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.countRequests(http.MethodPost, "/v1/domains/domain-id/records"); n != 1 {
+		t.Fatalf("expected 1 record to be created, got %d", n)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+
+	got, ok := records[0].(libdns.TXT).ProviderData.(RecordMetadata)
+	if !ok || got.UUID != old.UUID || !got.AlreadyPresent {
+		t.Fatalf("expected the existing record to be returned, got %+v", records[0])
+	}
+	if got, _ := records[1].(libdns.TXT).ProviderData.(RecordMetadata); got.AlreadyPresent {
+		t.Fatalf("expected the new record not to be marked as present, got %+v", records[1])
+	}
+}
+
+func TestProvider_AppendRecordsConflict(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+
+	// Someone else creates the first record between the listing and its creation.
+	var raced conohaDNSRecord
+	var once sync.Once
+	fake.beforeRequest = func(r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/v1/domains/domain-id/records" {
+			once.Do(func() {
+				raced = fake.addRecord("domain-id", conohaDNSRecord{Name: "_acme-challenge.example.com.", Type: "TXT", Data: "token"})
+			})
+		}
+	}
+
+	records, err := p.AppendRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.TXT{Name: "_acme-challenge.example.com.", Text: "token"},
+		libdns.TXT{Name: "_acme-challenge.example.com.", Text: "other"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+
+	got, ok := records[0].(libdns.TXT).ProviderData.(RecordMetadata)
+	if !ok || got.UUID != raced.UUID || !got.AlreadyPresent {
+		t.Fatalf("expected the conflicting record to be returned as present, got %+v", records[0])
+	}
+	if len(fake.records["domain-id"]) != 2 {
+		t.Fatalf("expected 2 stored records, got %+v", fake.records["domain-id"])
+	}
+}
+
+func TestProvider_LogsRequestsWithoutSecrets(t *testing.T) {
+	p, _ := newTestProvider(t, "example.com.")
+
+	var buf strings.Builder
+	p.Logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	if _, err := p.GetRecords(context.TODO(), "example.com."); err != nil {
+		t.Fatal(err)
+	}
+
+	logs := buf.String()
+	for _, want := range []string{"method=POST", "/v3/auth/tokens", "method=GET", "/v1/domains", "status=200", "latency="} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("expected logs to contain %q, got:\n%s", want, logs)
+		}
+	}
+	for _, secret := range []string{p.APIPassword, "fake-token"} {
+		if strings.Contains(logs, secret) {
+			t.Errorf("logs leak %q:\n%s", secret, logs)
+		}
+	}
+}
+
+func TestProvider_StringMasksPassword(t *testing.T) {
+	p := &Provider{APITenantID: "tenant", APIUserID: "user", APIPassword: "s3cret", Region: "c3j1"}
+
+	for _, format := range []string{"%v", "%+v", "%s", "%#v"} {
+		got := fmt.Sprintf(format, p)
+		if strings.Contains(got, "s3cret") {
+			t.Errorf("%s leaks the password: %s", format, got)
+		}
+		if !strings.Contains(got, `"tenant"`) {
+			t.Errorf("%s is missing the tenant ID: %s", format, got)
+		}
+	}
+}
+
+func TestProvider_DeleteRecordsByUUID(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "_acme-challenge.example.com.", Type: "TXT", Data: "first"})
+	second := fake.addRecord("domain-id", conohaDNSRecord{Name: "_acme-challenge.example.com.", Type: "TXT", Data: "second"})
+
+	deleted, err := p.DeleteRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.TXT{Name: "_acme-challenge.example.com.", Text: "second", ProviderData: RecordMetadata{UUID: second.UUID}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 {
+		t.Fatalf("expected 1 deleted record, got %d", len(deleted))
+	}
+
+	remaining := fake.records["domain-id"]
+	if len(remaining) != 1 || remaining[0].Data != "first" {
+		t.Fatalf("expected only the first record to remain, got %+v", remaining)
+	}
+	if n := fake.countRequests(http.MethodGet, "/v1/domains/domain-id/records"); n != 0 {
+		t.Fatalf("expected no record lookup, got %d", n)
+	}
+}
+
+func TestProvider_DeleteRecordsByUUIDAndName(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	first := fake.addRecord("domain-id", conohaDNSRecord{Name: "_acme-challenge.example.com.", Type: "TXT", Data: "first"})
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "_acme-challenge.example.com.", Type: "TXT", Data: "second"})
+
+	// The lookup by name and type comes first but mustn't pick the record deleted by UUID.
+	deleted, err := p.DeleteRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.RR{Name: "_acme-challenge.example.com.", Type: "TXT"},
+		libdns.TXT{Name: "_acme-challenge.example.com.", Text: "first", ProviderData: RecordMetadata{UUID: first.UUID}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 2 || len(fake.records["domain-id"]) != 0 {
+		t.Fatalf("expected both records to be deleted, got %d deleted and %+v left", len(deleted), fake.records["domain-id"])
+	}
+}
+
+func TestProvider_DeleteRecordsWithoutData(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "www.example.com.", Type: "A", Data: "192.0.2.1"})
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "www.example.com.", Type: "A", Data: "192.0.2.2"})
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "www.example.com.", Type: "AAAA", Data: "2001:db8::1"})
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "example.com.", Type: "MX", Data: "10 mail.example.com."})
+
+	deleted, err := p.DeleteRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.RR{Name: "www.example.com.", Type: "A"},
+		libdns.MX{Name: "example.com."},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, rec := range deleted {
+		got = append(got, rec.RR().Type+" "+rec.RR().Data)
+	}
+	if want := []string{"A 192.0.2.1", "A 192.0.2.2", "MX 10 mail.example.com."}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected every matching record to be deleted, got %v", got)
+	}
+	if remaining := fake.records["domain-id"]; len(remaining) != 1 || remaining[0].Type != "AAAA" {
+		t.Fatalf("expected only the AAAA record to remain, got %+v", remaining)
+	}
+}
+
+func TestProvider_DeleteRecordsMatchesData(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "_acme-challenge.example.com.", Type: "TXT", Data: "first"})
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "_acme-challenge.example.com.", Type: "TXT", Data: "second"})
+
+	if _, err := p.DeleteRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.TXT{Name: "_acme-challenge.example.com.", Text: "second"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	remaining := fake.records["domain-id"]
+	if len(remaining) != 1 || remaining[0].Data != "first" {
+		t.Fatalf("expected only the first record to remain, got %+v", remaining)
+	}
+
+	// Without data, the record is matched by name and type only.
+	if _, err := p.DeleteRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.TXT{Name: "_acme-challenge.example.com."},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if remaining := fake.records["domain-id"]; len(remaining) != 0 {
+		t.Fatalf("expected no records to remain, got %+v", remaining)
+	}
+
+	// A value matching no record deletes nothing.
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "_acme-challenge.example.com.", Type: "TXT", Data: "first"})
+	deleted, err := p.DeleteRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.TXT{Name: "_acme-challenge.example.com.", Text: "other"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 0 || len(fake.records["domain-id"]) != 1 {
+		t.Fatalf("expected nothing to be deleted, got %+v", deleted)
+	}
+}
+
+func TestProvider_DeleteRecordsListsZoneOnce(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	var records []libdns.Record
+	for i := 0; i < 5; i++ {
+		fake.addRecord("domain-id", conohaDNSRecord{Name: "_acme-challenge.example.com.", Type: "TXT", Data: fmt.Sprintf("token%d", i)})
+		records = append(records, libdns.TXT{Name: "_acme-challenge.example.com.", Text: fmt.Sprintf("token%d", i)})
+	}
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "www.example.com.", Type: "TXT", Data: "first"})
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "www.example.com.", Type: "TXT", Data: "second"})
+	// A lookup by name and type only deletes both records.
+	records = append(records, libdns.RR{Name: "www.example.com.", Type: "TXT"})
+
+	deleted, err := p.DeleteRecords(context.TODO(), "example.com.", records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 7 || len(fake.records["domain-id"]) != 0 {
+		t.Fatalf("expected every record to be deleted, got %d deleted and %+v left", len(deleted), fake.records["domain-id"])
+	}
+	if n := fake.countRequests(http.MethodGet, "/v1/domains/domain-id/records"); n != 1 {
+		t.Fatalf("expected the records to be listed once, got %d", n)
+	}
+}
+
+func TestProvider_DeleteAllRecords(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "_acme-challenge.example.com.", Type: "TXT", Data: "first"})
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "_acme-challenge.example.com.", Type: "TXT", Data: "second"})
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "_acme-challenge.example.com.", Type: "TXT", Data: "third"})
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "example.com.", Type: "TXT", Data: "first"})
+
+	deleted, err := p.DeleteAllRecords(context.TODO(), "example.com.", "_acme-challenge.example.com.", "TXT", "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 || deleted[0].RR().Data != "second" {
+		t.Fatalf("expected the second record to be deleted, got %+v", deleted)
+	}
+
+	deleted, err = p.DeleteAllRecords(context.TODO(), "example.com.", "_acme-challenge.example.com.", "TXT", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 2 {
+		t.Fatalf("expected 2 deleted records, got %d", len(deleted))
+	}
+
+	remaining := fake.records["domain-id"]
+	if len(remaining) != 1 || remaining[0].Name != "example.com." {
+		t.Fatalf("expected only the apex record to remain, got %+v", remaining)
+	}
+}
+
+func TestProvider_DeleteAllRecordsMixedCase(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "_ACME-Challenge.Example.com.", Type: "TXT", Data: "first"})
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "_acme-challenge.example.com.", Type: "TXT", Data: "second"})
+
+	deleted, err := p.DeleteAllRecords(context.TODO(), "example.com.", "_acme-challenge.EXAMPLE.com.", "TXT", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 2 || len(fake.records["domain-id"]) != 0 {
+		t.Fatalf("expected both records to be deleted, got %d deleted and %+v left", len(deleted), fake.records["domain-id"])
+	}
+}
+
+func TestProvider_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider *Provider
+		wantErrs []string
+	}{
+		{
+			name:     "valid",
+			provider: &Provider{APITenantID: "tenant", APIUserID: "user", APIPassword: "password"},
+		},
+		{
+			name:     "missing credentials",
+			provider: &Provider{APIUserID: "user"},
+			wantErrs: []string{"APITenantID or APITenantName is required", "APIPassword is required"},
+		},
+		{
+			name:     "unknown region",
+			provider: &Provider{APITenantID: "tenant", APIUserID: "user", APIPassword: "password", Region: "c3jj1"},
+			wantErrs: []string{`unknown region "c3jj1"`},
+		},
+		{
+			name: "region declared in RegionEndpoints",
+			provider: &Provider{APITenantID: "tenant", APIUserID: "user", APIPassword: "password", Region: "c3j2",
+				RegionEndpoints: map[string]RegionEndpoints{"c3j2": {}}},
+		},
+		{
+			name: "region unused with both endpoints",
+			provider: &Provider{APITenantID: "tenant", APIUserID: "user", APIPassword: "password", Region: "c3jj1",
+				IdentityEndpoint: "http://127.0.0.1:5000", DNSEndpoint: "http://127.0.0.1:5001"},
+		},
+		{
+			name:     "relative endpoint",
+			provider: &Provider{APITenantID: "tenant", APIUserID: "user", APIPassword: "password", DNSEndpoint: "dns.example"},
+			wantErrs: []string{`DNSEndpoint "dns.example" is not an absolute URL`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.provider.Validate()
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected errors %q", tt.wantErrs)
+			}
+			for _, want := range tt.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected %q in %v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestProvider_ReusesClient(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+
+	if _, err := p.GetRecords(context.TODO(), "example.com."); err != nil {
+		t.Fatal(err)
+	}
+	client := p.client
+
+	// An expiring token is refreshed on the existing client.
+	p.token.expiresAt = time.Now()
+	if _, err := p.GetRecords(context.TODO(), "example.com."); err != nil {
+		t.Fatal(err)
+	}
+	if p.client != client {
+		t.Fatal("expected the DNS client to be reused")
+	}
+	if n := fake.countRequests(http.MethodPost, "/v3/auth/tokens"); n != 2 {
+		t.Fatalf("expected 2 token requests, got %d", n)
+	}
+}
+
+func TestProvider_InsecureSkipVerify(t *testing.T) {
+	fake := &fakeConoHa{
+		domains: []domain{{UUID: "domain-id", Name: "example.com."}},
+		records: map[string][]conohaDNSRecord{},
+	}
+	server := httptest.NewTLSServer(fake)
+	t.Cleanup(server.Close)
+
+	p := &Provider{
+		APITenantID:      "tenant",
+		APIUserID:        "user",
+		APIPassword:      "password",
+		IdentityEndpoint: server.URL,
+		DNSEndpoint:      server.URL,
+		AuthMaxRetries:   -1,
+	}
+	if _, err := p.GetRecords(context.TODO(), "example.com."); err == nil {
+		t.Fatal("expected the self-signed certificate to be rejected")
+	}
+
+	p = &Provider{
+		APITenantID:        "tenant",
+		APIUserID:          "user",
+		APIPassword:        "password",
+		IdentityEndpoint:   server.URL,
+		DNSEndpoint:        server.URL,
+		InsecureSkipVerify: true,
+	}
+	if _, err := p.GetRecords(context.TODO(), "example.com."); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProvider_UnknownZone(t *testing.T) {
+	p, _ := newTestProvider(t, "example.com.")
+
+	_, err := p.GetRecords(context.TODO(), "unknown.example.")
+	if !errors.Is(err, ErrZoneNotFound) {
+		t.Fatalf("expected ErrZoneNotFound, got %v", err)
+	}
+}
+
+func TestProvider_AppendRecordsReturnsServerTTL(t *testing.T) {
+	p, _ := newTestProvider(t, "example.com.")
+
+	created, err := p.AppendRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.TXT{Name: "test.example.com.", Text: "value"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(created))
+	}
+
+	// The fake server applies a default TTL of one hour, like ConoHa.
+	if ttl := created[0].RR().TTL; ttl != time.Hour {
+		t.Fatalf("expected the server-assigned TTL, got %v", ttl)
+	}
+}
+
+func TestProvider_DryRun(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	p.DryRun = true
+	stale := fake.addRecord("domain-id", conohaDNSRecord{Name: "www.example.com.", Type: "A", Data: "192.0.2.1"})
+	extra := fake.addRecord("domain-id", conohaDNSRecord{Name: "www.example.com.", Type: "A", Data: "192.0.2.2"})
+
+	set, err := p.SetRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.Address{Name: "www.example.com.", IP: netip.MustParseAddr("192.0.2.3")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set) != 1 || set[0].RR().Data != "192.0.2.3" {
+		t.Fatalf("expected the planned records, got %+v", set)
+	}
+
+	deleted, err := p.DeleteRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.Address{Name: "www.example.com.", IP: netip.MustParseAddr("192.0.2.1")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 {
+		t.Fatalf("expected 1 planned deletion, got %d", len(deleted))
+	}
+
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodDelete} {
+		if n := fake.countRequests(method, "/v1/"); n != 0 {
+			t.Fatalf("expected no %s request, got %d", method, n)
+		}
+	}
+	if len(fake.records["domain-id"]) != 2 {
+		t.Fatalf("expected the zone to be unchanged, got %+v", fake.records["domain-id"])
+	}
+
+	plan := p.DryRunPlan()
+	want := []PlannedChange{
+		{Action: "update", RecordID: stale.UUID, Record: libdns.Address{Name: "www.example.com.", IP: netip.MustParseAddr("192.0.2.3"), ProviderData: RecordMetadata{UUID: stale.UUID}}},
+		{Action: "delete", RecordID: extra.UUID},
+		{Action: "delete", RecordID: stale.UUID},
+	}
+	if !reflect.DeepEqual(plan, want) {
+		t.Fatalf("unexpected plan:\n got %+v\nwant %+v", plan, want)
+	}
+	if plan := p.DryRunPlan(); len(plan) != 0 {
+		t.Fatalf("expected the plan to be reset, got %+v", plan)
+	}
+}
+
+func TestProvider_DryRunToggled(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+
+	writes := func() int {
+		n := 0
+		for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodDelete} {
+			n += fake.countRequests(method, "/v1/")
+		}
+		return n
+	}
+	appendRecord := func(text string) {
+		t.Helper()
+		if _, err := p.AppendRecords(context.TODO(), "example.com.", []libdns.Record{
+			libdns.TXT{Name: "test.example.com.", Text: text},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The client is built by a first call made with DryRun off.
+	if _, err := p.GetRecords(context.TODO(), "example.com."); err != nil {
+		t.Fatal(err)
+	}
+
+	p.DryRun = true
+	appendRecord("planned")
+	if n := writes(); n != 0 || len(fake.records["domain-id"]) != 0 {
+		t.Fatalf("expected no write in dry-run mode, got %d", n)
+	}
+	if plan := p.DryRunPlan(); len(plan) != 1 {
+		t.Fatalf("expected 1 planned change, got %+v", plan)
+	}
+
+	p.DryRun = false
+	appendRecord("applied")
+	if n := writes(); n != 1 || len(fake.records["domain-id"]) != 1 {
+		t.Fatalf("expected the record to be created once DryRun is off, got %d writes", n)
+	}
+	if plan := p.DryRunPlan(); len(plan) != 0 {
+		t.Fatalf("expected no planned change, got %+v", plan)
+	}
+}
+
+func TestProvider_AppendRecordsDeduplicatesInput(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	p.Concurrency = 4
+
+	created, err := p.AppendRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.TXT{Name: "_acme-challenge.example.com.", Text: "token"},
+		libdns.TXT{Name: "_acme-challenge.example.com.", Text: "token"},
+		libdns.TXT{Name: "_acme-challenge.example.com.", Text: "other"},
+		libdns.TXT{Name: "_acme-challenge.example.com.", Text: "token"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(created))
+	}
+	if n := len(fake.records["domain-id"]); n != 2 {
+		t.Fatalf("expected 2 stored records, got %d", n)
+	}
+}
+
+func TestConvertALIASRecord(t *testing.T) {
+	raw := conohaDNSRecord{
+		Name: "example.com.",
+		Type: "ALIAS",
+		Data: "lb.example.net.",
+		TTL:  300,
+	}
+
+	converted, err := convertToLibdnsRecord(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alias, ok := converted.(ALIAS)
+	if !ok {
+		t.Fatalf("expected ALIAS, got %T", converted)
+	}
+	if alias.Target != "lb.example.net." || alias.TTL != 5*time.Minute {
+		t.Fatalf("unexpected record: %+v", alias)
+	}
+
+	for _, rec := range []libdns.Record{alias, alias.RR()} {
+		back, err := convertToConohaDNSRecord(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if back != raw {
+			t.Fatalf("unexpected conversion of %T: got %+v, want %+v", rec, back, raw)
+		}
+	}
+}
+
+func TestProvider_GetRecord(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "www.example.com.", Type: "A", Data: "192.0.2.1"})
+
+	rec, found, err := p.GetRecord(context.TODO(), "example.com.", "www.example.com.", "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || rec.RR().Data != "192.0.2.1" {
+		t.Fatalf("unexpected result: %+v, %v", rec, found)
+	}
+
+	rec, found, err = p.GetRecord(context.TODO(), "example.com.", "WWW.Example.com.", "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || rec.RR().Data != "192.0.2.1" {
+		t.Fatalf("expected names to match case-insensitively, got %+v, %v", rec, found)
+	}
+
+	rec, found, err = p.GetRecord(context.TODO(), "example.com.", "www.example.com.", "AAAA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found || rec != nil {
+		t.Fatalf("expected no record, got %+v", rec)
+	}
+}
+
+func TestProvider_GetRecordsSkipsMalformed(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "good.example.com.", Type: "A", Data: "192.0.2.1"})
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "bad.example.com.", Type: "A", Data: "not-an-ip"})
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "good.example.com.", Type: "TXT", Data: "value"})
+
+	records, err := p.GetRecords(context.TODO(), "example.com.")
+	if err == nil || !strings.Contains(err.Error(), "bad.example.com.") {
+		t.Fatalf("expected an error naming the malformed record, got %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected the 2 valid records, got %+v", records)
+	}
+}
+
+func TestProvider_GetRecordsApexNS(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "example.com.", Type: "NS", Data: "ns-a1.conoha.io."})
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "example.com.", Type: "NS", Data: "ns-a2.conoha.io."})
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "www.example.com.", Type: "A", Data: "192.0.2.1"})
+
+	records, err := p.GetRecords(context.TODO(), "example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var targets []string
+	for _, rec := range records {
+		if ns, ok := rec.(libdns.NS); ok {
+			if ns.Name != "example.com." {
+				t.Errorf("unexpected NS record name: %q", ns.Name)
+			}
+			targets = append(targets, ns.Target)
+		}
+	}
+	if want := []string{"ns-a1.conoha.io.", "ns-a2.conoha.io."}; !reflect.DeepEqual(targets, want) {
+		t.Fatalf("expected the apex NS records, got %v", targets)
+	}
+}
+
+func TestProvider_GetRecordsByType(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "www.example.com.", Type: "A", Data: "192.0.2.1"})
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "_acme-challenge.example.com.", Type: "TXT", Data: "token"})
+
+	records, err := p.GetRecordsByType(context.TODO(), "example.com.", "TXT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].RR().Type != "TXT" {
+		t.Fatalf("expected only the TXT record, got %+v", records)
+	}
+
+	// Types are compared case-insensitively.
+	records, err = p.GetRecordsByType(context.TODO(), "example.com.", "txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].RR().Type != "TXT" {
+		t.Fatalf("expected the TXT record for a lowercase type, got %+v", records)
+	}
+	if _, found, err := p.GetRecord(context.TODO(), "example.com.", "www.example.com.", "a"); err != nil || !found {
+		t.Fatalf("expected GetRecord to find the A record for a lowercase type, got %v, %v", found, err)
+	}
+	deleted, err := p.DeleteAllRecords(context.TODO(), "example.com.", "_acme-challenge.example.com.", "txt", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 {
+		t.Fatalf("expected DeleteAllRecords to delete the TXT record for a lowercase type, got %+v", deleted)
+	}
+}
+
+func TestProvider_RequestLimiterSharedByProviders(t *testing.T) {
+	const limit = 2
+
+	p, fake := newTestProvider(t, "example.com.")
+	other := &Provider{APITenantID: "tenant", APIUserID: "user", APIPassword: "password", HTTPClient: p.HTTPClient}
+	limiter := NewRequestLimiter(limit)
+	for _, provider := range []*Provider{p, other} {
+		provider.RequestLimiter = limiter
+		provider.Concurrency = maxConcurrency
+	}
+
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	fake.beforeRequest = func(r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}
+
+	var wg sync.WaitGroup
+	for i, provider := range []*Provider{p, other} {
+		var records []libdns.Record
+		for j := 0; j < 10; j++ {
+			records = append(records, libdns.TXT{Name: fmt.Sprintf("test%d.example.com.", i), Text: fmt.Sprintf("value%d", j)})
+		}
+
+		provider, records := provider, records
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := provider.AppendRecords(context.TODO(), "example.com.", records); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(fake.records["domain-id"]) != 20 {
+		t.Fatalf("expected 20 records, got %d", len(fake.records["domain-id"]))
+	}
+	if maxInFlight != limit {
+		t.Fatalf("expected at most %d requests in flight, got %d", limit, maxInFlight)
+	}
+}
+
+func TestProvider_ZonesRunConcurrently(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	fake.domains = append(fake.domains, domain{UUID: "other-id", Name: "example.net."})
+
+	// Listing the records of example.com. waits until those of example.net. are requested,
+	// which only happens if operations on the two zones aren't serialized.
+	otherRequested := make(chan struct{})
+	var once sync.Once
+	fake.beforeRequest = func(r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/domains/other-id/records":
+			once.Do(func() { close(otherRequested) })
+		case "/v1/domains/domain-id/records":
+			select {
+			case <-otherRequested:
+			case <-time.After(5 * time.Second):
+				t.Error("operations on different zones were serialized")
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, zone := range []string{"example.com.", "example.net."} {
+		zone := zone
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := p.AppendRecords(context.TODO(), zone, []libdns.Record{
+				libdns.TXT{Name: "_acme-challenge." + zone, Text: "value"},
+			}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := fake.countRequests(http.MethodPost, "/v3/auth/tokens"); got != 1 {
+		t.Fatalf("expected the token to be shared, got %d authentications", got)
+	}
+}
+
+// recordingMetrics is a Metrics collecting the "METHOD endpoint status" of each request.
+type recordingMetrics struct {
+	mu       sync.Mutex
+	requests []string
+}
+
+func (m *recordingMetrics) OnRequest(method, endpoint string, status int, dur time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests = append(m.requests, fmt.Sprintf("%s %s %d", method, endpoint, status))
+}
+
+func TestProvider_Metrics(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	rec := fake.addRecord("domain-id", conohaDNSRecord{Name: "www.example.com.", Type: "A", Data: "192.0.2.1"})
+	metrics := &recordingMetrics{}
+	p.Metrics = metrics
+
+	if _, err := p.DeleteRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.Address{Name: "www.example.com.", IP: netip.MustParseAddr("192.0.2.1"), ProviderData: RecordMetadata{UUID: rec.UUID}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"POST /v3/auth/tokens 201",
+		"GET /v1/domains 200",
+		"DELETE /v1/domains/{domain_id}/records/{record_id} 204",
+	}
+	if !reflect.DeepEqual(metrics.requests, want) {
+		t.Fatalf("unexpected requests:\ngot  %q\nwant %q", metrics.requests, want)
+	}
+}
+
+func TestProvider_DefaultZone(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "www.example.com.", Type: "A", Data: "192.0.2.1"})
+	fake.mu.Lock()
+	fake.domains = append(fake.domains, domain{UUID: "other-id", Name: "example.net."})
+	fake.mu.Unlock()
+	fake.addRecord("other-id", conohaDNSRecord{Name: "www.example.net.", Type: "A", Data: "192.0.2.2"})
+
+	if _, err := p.GetRecords(context.TODO(), ""); err == nil {
+		t.Fatal("expected an error without zone and DefaultZone")
+	}
+
+	p.DefaultZone = "example.com."
+	records, err := p.GetRecords(context.TODO(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].RR().Data != "192.0.2.1" {
+		t.Fatalf("expected the records of DefaultZone, got %+v", records)
+	}
+
+	records, err = p.GetRecords(context.TODO(), "example.net.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].RR().Data != "192.0.2.2" {
+		t.Fatalf("expected the records of the explicit zone, got %+v", records)
+	}
+}
+
+func TestProvider_ReauthenticatesOnRevokedToken(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+
+	if _, err := p.GetRecords(context.TODO(), "example.com."); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.revokeTokens("rotated-token")
+	if _, err := p.AppendRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.TXT{Name: "_acme-challenge.example.com.", Text: "value"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := fake.countRequests(http.MethodPost, "/v3/auth/tokens"); got != 2 {
+		t.Fatalf("expected 2 authentications, got %d", got)
+	}
+	if got := fake.countRequests(http.MethodPost, "/v1/domains/domain-id/records"); got != 1 {
+		t.Fatalf("expected the record to be created once, got %d", got)
+	}
+}
+
+func TestProvider_RefreshToken(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+
+	if _, err := p.GetRecords(context.TODO(), "example.com."); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.revokeTokens("rotated-token")
+	if err := p.RefreshToken(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.countRequests(http.MethodPost, "/v3/auth/tokens"); got != 2 {
+		t.Fatalf("expected 2 authentications, got %d", got)
+	}
+
+	// The new token is used right away, without being rejected first.
+	if _, err := p.GetRecords(context.TODO(), "example.com."); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.countRequests(http.MethodGet, "/v1/domains/domain-id/records"); got != 2 {
+		t.Fatalf("expected 2 record listings, got %d", got)
+	}
+	if got := fake.countRequests(http.MethodPost, "/v3/auth/tokens"); got != 2 {
+		t.Fatalf("expected no further authentication, got %d", got)
+	}
+}
+
+func TestProvider_GetZoneSerial(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+
+	if _, err := p.GetZoneSerial(context.TODO(), "example.com."); err == nil {
+		t.Fatal("expected an error without SOA record")
+	}
+
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "www.example.com.", Type: "A", Data: "192.0.2.1"})
+	fake.addRecord("domain-id", conohaDNSRecord{
+		Name: "example.com.",
+		Type: "SOA",
+		Data: "ns-a1.conoha.io. hostmaster.example.com. 1700000001 3600 600 86400 3600",
+	})
+
+	serial, err := p.GetZoneSerial(context.TODO(), "example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serial != 1700000001 {
+		t.Fatalf("unexpected serial: %d", serial)
+	}
+}
+
+func TestProvider_SetRecordsMulti(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	fake.domains = append(fake.domains, domain{UUID: "other-id", Name: "example.net."})
+
+	results, err := p.SetRecordsMulti(context.TODO(), map[string][]libdns.Record{
+		"example.com.": {libdns.TXT{Name: "test.example.com.", Text: "com"}},
+		"example.net.": {libdns.TXT{Name: "test.example.net.", Text: "net"}},
+		"missing.org.": {libdns.TXT{Name: "test.missing.org.", Text: "org"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for zone, want := range map[string]string{"example.com.": "com", "example.net.": "net"} {
+		result := results[zone]
+		if result.Err != nil || len(result.Records) != 1 || result.Records[0].RR().Data != want {
+			t.Fatalf("unexpected result for %s: %+v", zone, result)
+		}
+	}
+	if result := results["missing.org."]; !errors.Is(result.Err, ErrZoneNotFound) {
+		t.Fatalf("expected ErrZoneNotFound for the missing zone, got %+v", result)
+	}
+
+	if len(fake.records["domain-id"]) != 1 || len(fake.records["other-id"]) != 1 {
+		t.Fatalf("unexpected records: %+v", fake.records)
+	}
+	if n := fake.countRequests(http.MethodPost, "/v3/auth/tokens"); n != 1 {
+		t.Fatalf("expected a single token request, got %d", n)
+	}
+}
+
+func TestProvider_CNAMEConflict(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []libdns.Record
+		wantErr bool
+	}{
+		{name: "CNAME next to an A record", records: []libdns.Record{libdns.CNAME{Name: "www.example.com.", Target: "example.net."}}, wantErr: true},
+		{name: "TXT next to a CNAME record", records: []libdns.Record{libdns.TXT{Name: "alias.example.com.", Text: "value"}}, wantErr: true},
+		{name: "CNAME and TXT requested together", records: []libdns.Record{
+			libdns.CNAME{Name: "new.example.com.", Target: "example.net."},
+			libdns.TXT{Name: "NEW.example.com.", Text: "value"},
+		}, wantErr: true},
+		{name: "same CNAME again", records: []libdns.Record{libdns.CNAME{Name: "alias.example.com.", Target: "example.net."}}},
+		{name: "CNAME at a free name", records: []libdns.Record{libdns.CNAME{Name: "new.example.com.", Target: "example.net."}}},
+	}
+
+	for _, tt := range tests {
+		for _, method := range []string{"AppendRecords", "SetRecords"} {
+			t.Run(method+"/"+tt.name, func(t *testing.T) {
+				p, fake := newTestProvider(t, "example.com.")
+				fake.addRecord("domain-id", conohaDNSRecord{Name: "www.example.com.", Type: "A", Data: "192.0.2.1"})
+				fake.addRecord("domain-id", conohaDNSRecord{Name: "alias.example.com.", Type: "CNAME", Data: "example.net."})
+
+				var err error
+				if method == "AppendRecords" {
+					_, err = p.AppendRecords(context.TODO(), "example.com.", tt.records)
+				} else {
+					_, err = p.SetRecords(context.TODO(), "example.com.", tt.records)
+				}
+
+				if tt.wantErr != errors.Is(err, ErrCNAMEConflict) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if tt.wantErr && len(fake.records["domain-id"]) != 2 {
+					t.Fatalf("expected no record to be written, got %+v", fake.records["domain-id"])
+				}
+			})
+		}
+	}
+}
+
+func TestProvider_EnsureRecord(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "www.example.com.", Type: "TXT", Data: "other"})
+
+	steps := []struct {
+		rec  libdns.Record
+		want EnsureAction
+	}{
+		{rec: libdns.TXT{Name: "test.example.com.", Text: "first"}, want: EnsureCreated},
+		{rec: libdns.TXT{Name: "test.example.com.", Text: "first"}, want: EnsureUnchanged},
+		{rec: libdns.TXT{Name: "test.example.com.", Text: "second"}, want: EnsureUpdated},
+	}
+	for _, step := range steps {
+		stored, action, err := p.EnsureRecord(context.TODO(), "example.com.", step.rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if action != step.want {
+			t.Fatalf("ensuring %+v: expected %q, got %q", step.rec, step.want, action)
+		}
+		if stored.RR().Data != step.rec.RR().Data || recordMetadata(stored).UUID == "" {
+			t.Fatalf("unexpected stored record: %+v", stored)
+		}
+	}
+
+	var got []string
+	for _, rec := range fake.records["domain-id"] {
+		got = append(got, rec.Name+" "+rec.Data)
+	}
+	if want := []string{"www.example.com. other", "test.example.com. second"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected records: got %q, want %q", got, want)
+	}
+}
+
+func TestRecordsEqual(t *testing.T) {
+	tests := []struct {
+		name       string
+		a, b       libdns.Record
+		compareTTL bool
+		want       bool
+	}{
+		{
+			name: "same record as different types",
+			a:    libdns.TXT{Name: "test.example.com.", Text: "value", TTL: time.Hour},
+			b:    libdns.RR{Name: "TEST.example.com.", Type: "TXT", Data: "value", TTL: time.Minute},
+			want: true,
+		},
+		{
+			name:       "different TTL",
+			a:          libdns.TXT{Name: "test.example.com.", Text: "value", TTL: time.Hour},
+			b:          libdns.TXT{Name: "test.example.com.", Text: "value", TTL: time.Minute},
+			compareTTL: true,
+			want:       false,
+		},
+		{
+			name: "different data",
+			a:    libdns.TXT{Name: "test.example.com.", Text: "value"},
+			b:    libdns.TXT{Name: "test.example.com.", Text: "other"},
+			want: false,
+		},
+		{
+			name:       "unsupported type",
+			a:          libdns.RR{Name: "example.com.", Type: "SOA", Data: "a. b. 1 2 3 4 5"},
+			b:          libdns.RR{Name: "example.com.", Type: "SOA", Data: "a. b. 1 2 3 4 5"},
+			compareTTL: true,
+			want:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RecordsEqual(tt.a, tt.b, tt.compareTTL); got != tt.want {
+				t.Fatalf("RecordsEqual() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProvider_PreservesGSLBAttributes(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	gslb := GSLB{Region: "JP", Weight: 10, Check: 443}
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "www.example.com.", Type: "A", Data: "192.0.2.1", GSLB: gslb})
+
+	records, err := p.GetRecords(context.TODO(), "example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta, _ := records[0].(libdns.Address).ProviderData.(RecordMetadata); meta.GSLB != gslb {
+		t.Fatalf("expected GSLB attributes in metadata, got %+v", records[0])
+	}
+
+	if _, err := p.SetRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.Address{Name: "www.example.com.", IP: netip.MustParseAddr("192.0.2.2")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.records["domain-id"][0]; got.Data != "192.0.2.2" || got.GSLB != gslb {
+		t.Fatalf("expected the GSLB attributes to survive the update, got %+v", got)
+	}
+
+	other := GSLB{Region: "US", Weight: 5}
+	if _, err := p.AppendRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.Address{Name: "www.example.com.", IP: netip.MustParseAddr("192.0.2.3"), ProviderData: RecordMetadata{GSLB: other}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.records["domain-id"][1]; got.GSLB != other {
+		t.Fatalf("expected the GSLB attributes to be sent, got %+v", got)
+	}
+}
+
+func TestProvider_RecordDescription(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "www.example.com.", Type: "A", Data: "192.0.2.1", Description: "web server"})
+
+	records, err := p.GetRecords(context.TODO(), "example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta := recordMetadata(records[0]); meta.Description != "web server" {
+		t.Fatalf("expected the description in metadata, got %+v", records[0])
+	}
+
+	// An update without a description keeps the stored one.
+	if _, err := p.SetRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.Address{Name: "www.example.com.", IP: netip.MustParseAddr("192.0.2.2")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.records["domain-id"][0]; got.Data != "192.0.2.2" || got.Description != "web server" {
+		t.Fatalf("expected the description to survive the update, got %+v", got)
+	}
+
+	// A new description is written even if the data is unchanged.
+	if _, err := p.SetRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.Address{Name: "www.example.com.", IP: netip.MustParseAddr("192.0.2.2"), ProviderData: RecordMetadata{Description: "moved"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.records["domain-id"][0]; got.Description != "moved" {
+		t.Fatalf("expected the description to be updated, got %+v", got)
+	}
+
+	if _, err := p.AppendRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.TXT{Name: "www.example.com.", Text: "value", ProviderData: RecordMetadata{Description: "verification"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.records["domain-id"][1]; got.Description != "verification" {
+		t.Fatalf("expected the description to be sent, got %+v", got)
+	}
+}
+
+func TestProvider_SetRecordsDetectsConcurrentChanges(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	readAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "test.example.com.", Type: "TXT", Data: "first", UpdatedAt: readAt})
+
+	read := func() libdns.TXT {
+		t.Helper()
+		records, err := p.GetRecords(context.TODO(), "example.com.")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return records[0].(libdns.TXT)
+	}
+
+	rec := read()
+	if meta := recordMetadata(rec); !meta.UpdatedAt.Equal(readAt) {
+		t.Fatalf("expected UpdatedAt in metadata, got %+v", meta)
+	}
+
+	// Another process changes the record between the read and the write.
+	fake.records["domain-id"][0].Data = "other"
+	fake.records["domain-id"][0].UpdatedAt = readAt.Add(time.Minute)
+
+	rec.Text = "second"
+	_, err := p.SetRecords(context.TODO(), "example.com.", []libdns.Record{rec})
+	var conflict *RecordConflictError
+	if !errors.As(err, &conflict) || !conflict.Read.Equal(readAt) || !conflict.Stored.Equal(readAt.Add(time.Minute)) {
+		t.Fatalf("expected a RecordConflictError, got %v", err)
+	}
+	if got := fake.records["domain-id"][0].Data; got != "other" {
+		t.Fatalf("expected the record to be left alone, got %q", got)
+	}
+
+	// Once read again, the record can be written.
+	rec = read()
+	rec.Text = "second"
+	if _, err := p.SetRecords(context.TODO(), "example.com.", []libdns.Record{rec}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.records["domain-id"][0].Data; got != "second" {
+		t.Fatalf("expected the record to be updated, got %q", got)
+	}
+
+	// A record deleted since it was read is a conflict too.
+	rec = read()
+	fake.records["domain-id"] = nil
+	if _, err := p.SetRecords(context.TODO(), "example.com.", []libdns.Record{rec}); !errors.As(err, &conflict) || !conflict.Stored.IsZero() {
+		t.Fatalf("expected a RecordConflictError for the deleted record, got %v", err)
+	}
+}
+
+func TestProvider_SetRecordsTwice(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	readAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "test.example.com.", Type: "TXT", Data: "first", UpdatedAt: readAt})
+
+	records, err := p.GetRecords(context.TODO(), "example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := records[0].(libdns.TXT)
+
+	// The records returned by SetRecords carry the UpdatedAt of the PUT response,
+	// so that they can be changed and set again without a conflict.
+	for _, text := range []string{"second", "third"} {
+		rec.Text = text
+		set, err := p.SetRecords(context.TODO(), "example.com.", []libdns.Record{rec})
+		if err != nil {
+			t.Fatalf("setting %q: %v", text, err)
+		}
+		if len(set) != 1 {
+			t.Fatalf("expected 1 record, got %+v", set)
+		}
+
+		rec = set[0].(libdns.TXT)
+		if meta, stored := recordMetadata(rec), fake.records["domain-id"][0]; !meta.UpdatedAt.Equal(stored.UpdatedAt) || meta.UpdatedAt.Equal(readAt) {
+			t.Fatalf("expected UpdatedAt %v from the response, got %v", stored.UpdatedAt, meta.UpdatedAt)
+		}
+	}
+	if got := fake.records["domain-id"][0].Data; got != "third" {
+		t.Fatalf("expected the record to be updated twice, got %q", got)
+	}
+}
+
+func TestValidateRecord(t *testing.T) {
+	p := &Provider{}
+
+	tests := []struct {
+		name    string
+		record  libdns.Record
+		wantErr bool
+	}{
+		{name: "A", record: libdns.RR{Name: "www.example.com.", Type: "A", Data: "192.0.2.1"}},
+		{name: "A with IPv6", record: libdns.RR{Name: "www.example.com.", Type: "A", Data: "2001:db8::1"}, wantErr: true},
+		{name: "AAAA", record: libdns.RR{Name: "www.example.com.", Type: "AAAA", Data: "2001:db8::1"}},
+		{name: "AAAA with IPv4", record: libdns.RR{Name: "www.example.com.", Type: "AAAA", Data: "::ffff:192.0.2.1"}, wantErr: true},
+		{name: "CNAME without target", record: libdns.CNAME{Name: "www.example.com."}, wantErr: true},
+		{name: "NS without target", record: libdns.NS{Name: "example.com."}, wantErr: true},
+		{name: "TXT without name", record: libdns.TXT{Text: "value"}, wantErr: true},
+		{name: "TTL too low", record: libdns.TXT{Name: "test.example.com.", Text: "value", TTL: 30 * time.Second}, wantErr: true},
+		{name: "TTL too high", record: libdns.TXT{Name: "test.example.com.", Text: "value", TTL: 48 * time.Hour}, wantErr: true},
+		{name: "TTL at bounds", record: libdns.TXT{Name: "test.example.com.", Text: "value", TTL: 24 * time.Hour}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := p.toConohaDNSRecord(tt.record)
+			if tt.wantErr != errors.Is(err, ErrInvalidRecord) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestProvider_LoadFromEnv(t *testing.T) {
+	t.Setenv(EnvAPITenantID, "tenant")
+	t.Setenv(EnvAPIUserID, "user")
+	t.Setenv(EnvAPIPassword, "password")
+	t.Setenv(EnvRegion, "")
+
+	p := &Provider{Region: "c3j1"}
+	if err := p.LoadFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if p.APITenantID != "tenant" || p.APIUserID != "user" || p.APIPassword != "password" || p.Region != "c3j1" {
+		t.Fatalf("unexpected configuration: %#v", p)
+	}
+
+	t.Setenv(EnvAPIPassword, "")
+	if err := (&Provider{}).LoadFromEnv(); err == nil || !strings.Contains(err.Error(), "APIPassword is required") {
+		t.Fatalf("expected a missing password error, got %v", err)
+	}
+}
+
+func TestProvider_Ping(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+
+	if err := p.Ping(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Ping(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.countRequests(http.MethodPost, "/v3/auth/tokens"); n != 2 {
+		t.Fatalf("expected a token request per ping, got %d", n)
+	}
+
+	p, _ = newTestProvider(t, "example.com.")
+	p.APIPassword = ""
+	if err := p.Ping(context.TODO()); err == nil {
+		t.Fatal("expected an error without a password")
+	}
+}
+
+func TestConvertKeepsUUID(t *testing.T) {
+	raws := []conohaDNSRecord{
+		{UUID: "record-a", Name: "www.example.com.", Type: "A", Data: "192.0.2.1", TTL: 300},
+		{UUID: "record-txt", Name: "www.example.com.", Type: "TXT", Data: "value", TTL: 300},
+		{UUID: "record-mx", Name: "example.com.", Type: "MX", Data: "10 mail.example.com.", TTL: 300},
+	}
+
+	for _, raw := range raws {
+		converted, err := convertToLibdnsRecord(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := recordMetadata(converted).UUID; got != raw.UUID {
+			t.Fatalf("%s: expected UUID %q, got %q", raw.Type, raw.UUID, got)
+		}
+	}
+}
+
+func TestProvider_GetThenDeleteTargetsExactRecord(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "_acme-challenge.example.com.", Type: "TXT", Data: "first"})
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "_acme-challenge.example.com.", Type: "TXT", Data: "second"})
+
+	records, err := p.GetRecords(context.TODO(), "example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Delete the second record under a stale value: the UUID alone identifies it.
+	second := records[1].(libdns.TXT)
+	second.Text = "stale"
+	if _, err := p.DeleteRecords(context.TODO(), "example.com.", []libdns.Record{second}); err != nil {
+		t.Fatal(err)
+	}
+
+	remaining := fake.records["domain-id"]
+	if len(remaining) != 1 || remaining[0].Data != "first" {
+		t.Fatalf("expected only the first record to remain, got %+v", remaining)
+	}
+}
+
+func TestProvider_DialContext(t *testing.T) {
+	fake := &fakeConoHa{
+		domains: []domain{{UUID: "domain-id", Name: "example.com."}},
+		records: map[string][]conohaDNSRecord{},
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	// Every connection is pinned to the test server, whatever the requested host.
+	var dialed []string
+	p := &Provider{
+		APITenantID: "tenant",
+		APIUserID:   "user",
+		APIPassword: "password",
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed = append(dialed, addr)
+			var d net.Dialer
+			return d.DialContext(ctx, network, server.Listener.Addr().String())
+		},
+		IdentityEndpoint: "http://identity.invalid",
+		DNSEndpoint:      "http://dns.invalid",
+	}
+
+	if _, err := p.GetRecords(context.TODO(), "example.com."); err != nil {
+		t.Fatal(err)
+	}
+	if len(dialed) == 0 {
+		t.Fatal("expected the custom dialer to be used")
+	}
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	records := []libdns.Record{
+		libdns.Address{Name: "www.example.com.", IP: netip.MustParseAddr("192.0.2.1"), TTL: 5 * time.Minute},
+		libdns.Address{Name: "www.example.com.", IP: netip.MustParseAddr("2001:db8::1"), TTL: time.Hour},
+		libdns.CNAME{Name: "alias.example.com.", Target: "www.example.com.", TTL: time.Hour},
+		libdns.TXT{Name: "test.example.com.", Text: "value with spaces", TTL: time.Hour},
+		libdns.TXT{Name: "test.example.com.", Text: `"quoted"`, TTL: time.Hour},
+		libdns.TXT{Name: "test.example.com.", Text: strings.Repeat("x", 600), TTL: time.Hour},
+	}
+
+	for _, rec := range records {
+		assertRoundTrip(t, rec)
+	}
+}
+
+func FuzzConvertTXTRoundTrip(f *testing.F) {
+	for _, seed := range []string{"value", `"quoted"`, `back\slash`, strings.Repeat("y", 300)} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, text string) {
+		assertRoundTrip(t, libdns.TXT{Name: "test.example.com.", Text: text, TTL: time.Hour})
+	})
+}
+
+// assertRoundTrip checks that rec keeps its name, type, data and TTL through both converters.
+func assertRoundTrip(t *testing.T, rec libdns.Record) {
+	t.Helper()
+
+	raw, err := convertToConohaDNSRecord(rec)
+	if err != nil {
+		t.Fatalf("%+v: %v", rec, err)
+	}
+	back, err := convertToLibdnsRecord(raw)
+	if err != nil {
+		t.Fatalf("%+v: %v", raw, err)
+	}
+
+	if got, want := back.RR(), rec.RR(); got != want {
+		t.Fatalf("round trip changed the record:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestProvider_GetRawRecords(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	want := []RawRecord{
+		fake.addRecord("domain-id", conohaDNSRecord{Name: "test.example.com.", Type: "TXT", Data: `"quoted" "strings"`}),
+		fake.addRecord("domain-id", conohaDNSRecord{Name: "example.com.", Type: "CAA", Data: `0 issue "letsencrypt.org"`}),
+	}
+
+	got, err := p.GetRawRecords(context.TODO(), "example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected records:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestProvider_SetRecordsCreatesWithTTL(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+	fake.addRecord("domain-id", conohaDNSRecord{Name: "www.example.com.", Type: "A", Data: "192.0.2.1", TTL: 3600})
+
+	if _, err := p.SetRecords(context.TODO(), "example.com.", []libdns.Record{
+		libdns.Address{Name: "www.example.com.", IP: netip.MustParseAddr("192.0.2.2"), TTL: 10 * time.Minute},
+		libdns.Address{Name: "www.example.com.", IP: netip.MustParseAddr("192.0.2.3"), TTL: 10 * time.Minute},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	records := fake.records["domain-id"]
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %+v", records)
+	}
+	// The first record was updated in place and keeps its TTL; the second was created.
+	if records[0].Data != "192.0.2.2" || records[0].TTL != 3600 {
+		t.Fatalf("unexpected updated record: %+v", records[0])
+	}
+	if records[1].Data != "192.0.2.3" || records[1].TTL != 600 {
+		t.Fatalf("expected the created record to have the requested TTL, got %+v", records[1])
+	}
+}
+
+func TestProvider_ReauthenticatesOnTenantChange(t *testing.T) {
+	p, fake := newTestProvider(t, "example.com.")
+
+	if _, err := p.GetRecords(context.TODO(), "example.com."); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.GetRecords(context.TODO(), "example.com."); err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.countRequests(http.MethodPost, "/v3/auth/tokens"); n != 1 {
+		t.Fatalf("expected the token to be reused, got %d token requests", n)
+	}
+
+	// Zone IDs belong to the previous tenant and must be looked up again.
+	p.APITenantID = "other-tenant"
+	if _, err := p.GetRecords(context.TODO(), "example.com."); err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.countRequests(http.MethodPost, "/v3/auth/tokens"); n != 2 {
+		t.Fatalf("expected a new token for the new tenant, got %d token requests", n)
+	}
+	if n := fake.countRequests(http.MethodGet, "/v1/domains") - fake.countRequests(http.MethodGet, "/v1/domains/"); n != 2 {
+		t.Fatalf("expected the zone to be looked up again, got %d lookups", n)
+	}
+}
+
+func TestConvertDSRecord(t *testing.T) {
+	raw := conohaDNSRecord{
+		Name: "sub.example.com.",
+		Type: "DS",
+		Data: "60485 5 1 2BB183AF5F22588179A53B0A98631FAD1A292118",
+		TTL:  3600,
+	}
+
+	converted, err := convertToLibdnsRecord(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, ok := converted.(DS)
+	if !ok {
+		t.Fatalf("expected DS, got %T", converted)
+	}
+	if ds.KeyTag != 60485 || ds.Algorithm != 5 || ds.DigestType != 1 || ds.Digest != "2BB183AF5F22588179A53B0A98631FAD1A292118" {
+		t.Fatalf("unexpected record: %+v", ds)
+	}
+
+	for _, rec := range []libdns.Record{ds, ds.RR()} {
+		back, err := convertToConohaDNSRecord(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if back != raw {
+			t.Fatalf("unexpected conversion of %T: got %+v, want %+v", rec, back, raw)
+		}
+	}
+
+	if _, err := convertToConohaDNSRecord(libdns.RR{Name: "sub.example.com.", Type: "DS", Data: "60485 5 1 not-hex"}); err == nil {
+		t.Fatal("expected an error for a malformed digest")
+	}
+}
+
+func TestConversionErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		convert func() error
+		want    error
+	}{
+		{name: "nil record", want: ErrNilRecord, convert: func() error {
+			_, err := convertToConohaDNSRecord(nil)
+			return err
+		}},
+		{name: "unparsable address", want: ErrRecordParse, convert: func() error {
+			_, err := convertToConohaDNSRecord(libdns.RR{Name: "www.example.com.", Type: "A", Data: "not-an-ip"})
+			return err
+		}},
+		{name: "malformed provider type", want: ErrRecordParse, convert: func() error {
+			_, err := convertToConohaDNSRecord(libdns.RR{Name: "sub.example.com.", Type: "DS", Data: "60485 5 1"})
+			return err
+		}},
+		{name: "unsupported type on write", want: ErrUnsupportedType, convert: func() error {
+			_, err := convertToConohaDNSRecord(libdns.RR{Name: "host.example.com.", Type: "HINFO", Data: `"PC" "Linux"`})
+			return err
+		}},
+		{name: "malformed data on read", want: ErrRecordParse, convert: func() error {
+			_, err := convertToLibdnsRecord(conohaDNSRecord{Name: "example.com.", Type: "MX", Data: "mail.example.com."})
+			return err
+		}},
+		{name: "unsupported type on read", want: ErrUnsupportedType, convert: func() error {
+			_, err := convertToLibdnsRecord(conohaDNSRecord{Name: "host.example.com.", Type: "HINFO", Data: `"PC" "Linux"`})
+			return err
+		}},
+	}
+
+	sentinels := []error{ErrNilRecord, ErrRecordParse, ErrUnsupportedType}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.convert()
+			for _, sentinel := range sentinels {
+				if errors.Is(err, sentinel) != (sentinel == tt.want) {
+					t.Fatalf("unexpected error %v: want %v", err, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestConvertSSHFPRecord(t *testing.T) {
+	raw := conohaDNSRecord{
+		Name: "host.example.com.",
+		Type: "SSHFP",
+		Data: "4 2 9f8a4e1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7",
+		TTL:  3600,
+	}
+
+	converted, err := convertToLibdnsRecord(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshfp, ok := converted.(SSHFP)
+	if !ok {
+		t.Fatalf("expected SSHFP, got %T", converted)
+	}
+	if sshfp.Algorithm != 4 || sshfp.FingerprintType != 2 || sshfp.Fingerprint != "9f8a4e1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7" {
+		t.Fatalf("unexpected record: %+v", sshfp)
+	}
+
+	for _, rec := range []libdns.Record{sshfp, sshfp.RR()} {
+		back, err := convertToConohaDNSRecord(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if back != raw {
+			t.Fatalf("unexpected conversion of %T: got %+v, want %+v", rec, back, raw)
+		}
+	}
+
+	if _, err := convertToConohaDNSRecord(libdns.RR{Name: "host.example.com.", Type: "SSHFP", Data: "4 2"}); err == nil {
+		t.Fatal("expected an error for a missing fingerprint")
+	}
+}
+
+func TestConvertNAPTRRecord(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  conohaDNSRecord
+		want NAPTR
+	}{
+		{
+			name: "regexp",
+			raw:  conohaDNSRecord{Name: "4.3.2.1.e164.arpa.", Type: "NAPTR", Data: `100 10 "u" "E2U+sip" "!^.*$!sip:info@example.com!" .`, TTL: 3600},
+			want: NAPTR{Name: "4.3.2.1.e164.arpa.", TTL: time.Hour, Order: 100, Preference: 10, Flags: "u", Service: "E2U+sip", Regexp: "!^.*$!sip:info@example.com!", Replacement: "."},
+		},
+		{
+			name: "empty regexp",
+			raw:  conohaDNSRecord{Name: "example.com.", Type: "NAPTR", Data: `100 50 "s" "SIP+D2U" "" _sip._udp.example.com.`, TTL: 3600},
+			want: NAPTR{Name: "example.com.", TTL: time.Hour, Order: 100, Preference: 50, Flags: "s", Service: "SIP+D2U", Replacement: "_sip._udp.example.com."},
+		},
+		{
+			name: "escaped characters",
+			raw:  conohaDNSRecord{Name: "example.com.", Type: "NAPTR", Data: `10 0 "u" "E2U+web" "!^(.*)$!https://example.com/\\1 \"x\"!" .`, TTL: 3600},
+			want: NAPTR{Name: "example.com.", TTL: time.Hour, Order: 10, Flags: "u", Service: "E2U+web", Regexp: `!^(.*)$!https://example.com/\1 "x"!`, Replacement: "."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			converted, err := convertToLibdnsRecord(tt.raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if converted != tt.want {
+				t.Fatalf("unexpected record: got %+v, want %+v", converted, tt.want)
+			}
+
+			for _, rec := range []libdns.Record{converted, converted.RR()} {
+				back, err := convertToConohaDNSRecord(rec)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if back != tt.raw {
+					t.Fatalf("unexpected conversion of %T: got %+v, want %+v", rec, back, tt.raw)
+				}
+			}
+		})
+	}
+
+	if _, err := convertToConohaDNSRecord(libdns.RR{Name: "example.com.", Type: "NAPTR", Data: `100 10 "u" "E2U+sip" "unclosed .`}); err == nil {
+		t.Fatal("expected an error for an unclosed quote")
+	}
+}
+
+func TestConvertTLSARecord(t *testing.T) {
+	raw := conohaDNSRecord{
+		Name: "_443._tcp.example.com.",
+		Type: "TLSA",
+		Data: "3 1 1 0D6FCE3EF5A77C8EAD5A3AE0A7D9F7F3C64D0DC6B6C27D9BD0E13F0B84E0D17A",
+		TTL:  3600,
+	}
+
+	converted, err := convertToLibdnsRecord(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsa, ok := converted.(TLSA)
+	if !ok {
+		t.Fatalf("expected TLSA, got %T", converted)
+	}
+	if tlsa.Port != 443 || tlsa.Protocol != "tcp" || tlsa.Name != "example.com." {
+		t.Fatalf("unexpected name labels: %+v", tlsa)
+	}
+	if tlsa.Usage != 3 || tlsa.Selector != 1 || tlsa.MatchingType != 1 || tlsa.CertData != "0D6FCE3EF5A77C8EAD5A3AE0A7D9F7F3C64D0DC6B6C27D9BD0E13F0B84E0D17A" {
+		t.Fatalf("unexpected record: %+v", tlsa)
+	}
+
+	for _, rec := range []libdns.Record{tlsa, tlsa.RR()} {
+		back, err := convertToConohaDNSRecord(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if back != raw {
+			t.Fatalf("unexpected conversion of %T: got %+v, want %+v", rec, back, raw)
+		}
+	}
+
+	upper := libdns.RR{Name: "_443._TCP.example.com.", Type: "TLSA", TTL: time.Hour, Data: raw.Data}
+	back, err := convertToConohaDNSRecord(upper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.Name != raw.Name {
+		t.Fatalf("expected name %q, got %q", raw.Name, back.Name)
+	}
+
+	for _, rr := range []libdns.RR{
+		{Name: "example.com.", Type: "TLSA", Data: raw.Data},
+		{Name: "_https._tcp.example.com.", Type: "TLSA", Data: raw.Data},
+		{Name: raw.Name, Type: "TLSA", Data: "3 1 1 not-hex"},
+	} {
+		if _, err := convertToConohaDNSRecord(rr); err == nil {
+			t.Fatalf("expected an error for %+v", rr)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package conohav3
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// This file holds provider-specific record types for RR types that libdns doesn't model.
+// They implement libdns.Record, so they can be returned alongside the libdns types.
+
+// SOA represents a parsed SOA-type record, which holds the authoritative information of a zone.
+// SOA records are managed by ConoHa: they are returned by GetRecords but can't be written.
+type SOA struct {
+	Name    string
+	TTL     time.Duration
+	MName   string        // Primary nameserver of the zone
+	RName   string        // Mailbox of the person responsible for the zone, in domain name form
+	Serial  uint32        // Version number of the zone
+	Refresh time.Duration // How often secondaries should refresh the zone
+	Retry   time.Duration // How long secondaries wait before retrying a failed refresh
+	Expire  time.Duration // How long secondaries keep serving the zone without a refresh
+	Minimum time.Duration // TTL used for negative responses
+
+	// Optional custom data associated with the provider serving this record.
+	ProviderData any
+}
+
+func (s SOA) RR() libdns.RR {
+	return libdns.RR{
+		Name: s.Name,
+		TTL:  s.TTL,
+		Type: "SOA",
+		Data: fmt.Sprintf("%s %s %d %d %d %d %d", s.MName, s.RName, s.Serial,
+			int(s.Refresh.Seconds()), int(s.Retry.Seconds()), int(s.Expire.Seconds()), int(s.Minimum.Seconds())),
+	}
+}
+
+// ALIAS represents a parsed ALIAS-type record, which points a name, typically the zone apex,
+// to another host name whose addresses are served in its place.
+// libdns has no ALIAS type; RR().Data holds the target, like for a CNAME record.
+type ALIAS struct {
+	Name   string
+	TTL    time.Duration
+	Target string // Host name the alias resolves to
+
+	// Optional custom data associated with the provider serving this record.
+	ProviderData any
+}
+
+func (a ALIAS) RR() libdns.RR {
+	return libdns.RR{
+		Name: a.Name,
+		TTL:  a.TTL,
+		Type: "ALIAS",
+		Data: a.Target,
+	}
+}
+
+// DS represents a parsed DS-type record, which delegates DNSSEC trust to a signed child zone.
+type DS struct {
+	Name       string
+	TTL        time.Duration
+	KeyTag     uint16 // Key tag of the DNSKEY record the digest refers to
+	Algorithm  uint8  // DNSSEC algorithm number of that key
+	DigestType uint8  // Algorithm used to compute Digest
+	Digest     string // Digest of the DNSKEY record, in hexadecimal
+
+	// Optional custom data associated with the provider serving this record.
+	ProviderData any
+}
+
+func (d DS) RR() libdns.RR {
+	return libdns.RR{
+		Name: d.Name,
+		TTL:  d.TTL,
+		Type: "DS",
+		Data: fmt.Sprintf("%d %d %d %s", d.KeyTag, d.Algorithm, d.DigestType, d.Digest),
+	}
+}
+
+// TLSA represents a parsed TLSA-type record, which associates a TLS certificate with a service for DANE.
+type TLSA struct {
+	// Port and Protocol make up the "_port._protocol." labels prepended to Name,
+	// e.g. 443 and "tcp" for "_443._tcp.example.com.". If both are zero, Name is used as is.
+	Port     uint16
+	Protocol string
+	Name     string
+
+	TTL          time.Duration
+	Usage        uint8  // Certificate usage, e.g. 3 for DANE-EE
+	Selector     uint8  // Whether CertData matches the full certificate (0) or its public key (1)
+	MatchingType uint8  // Whether CertData is the exact data (0), a SHA-256 (1) or a SHA-512 (2) hash
+	CertData     string // Certificate association data, in hexadecimal
+
+	// Optional custom data associated with the provider serving this record.
+	ProviderData any
+}
+
+func (t TLSA) RR() libdns.RR {
+	name := t.Name
+	if t.Port != 0 || t.Protocol != "" {
+		name = fmt.Sprintf("_%d._%s.%s", t.Port, strings.ToLower(t.Protocol), t.Name)
+	}
+	return libdns.RR{
+		Name: name,
+		TTL:  t.TTL,
+		Type: "TLSA",
+		Data: fmt.Sprintf("%d %d %d %s", t.Usage, t.Selector, t.MatchingType, t.CertData),
+	}
+}
+
+// SSHFP represents a parsed SSHFP-type record, which publishes the fingerprint of an SSH host key.
+type SSHFP struct {
+	Name            string
+	TTL             time.Duration
+	Algorithm       uint8  // Algorithm of the host key, e.g. 4 for Ed25519
+	FingerprintType uint8  // Hash used to compute Fingerprint, e.g. 2 for SHA-256
+	Fingerprint     string // Fingerprint of the host key, in hexadecimal
+
+	// Optional custom data associated with the provider serving this record.
+	ProviderData any
+}
+
+func (s SSHFP) RR() libdns.RR {
+	return libdns.RR{
+		Name: s.Name,
+		TTL:  s.TTL,
+		Type: "SSHFP",
+		Data: fmt.Sprintf("%d %d %s", s.Algorithm, s.FingerprintType, s.Fingerprint),
+	}
+}
+
+// NAPTR represents a parsed NAPTR-type record, used by ENUM and SIP to rewrite names into URIs.
+type NAPTR struct {
+	Name        string
+	TTL         time.Duration
+	Order       uint16 // Order in which the records must be processed, lowest first
+	Preference  uint16 // Preference among the records with the same Order, lowest first
+	Flags       string // Flags controlling the rewriting, e.g. "U" for a terminal URI
+	Service     string // Service parameters, e.g. "E2U+sip"
+	Regexp      string // Substitution expression applied to the name; often empty
+	Replacement string // Next domain name to look up, or "." when Regexp is used (default: ".")
+
+	// Optional custom data associated with the provider serving this record.
+	ProviderData any
+}
+
+func (n NAPTR) RR() libdns.RR {
+	replacement := n.Replacement
+	if replacement == "" {
+		replacement = "."
+	}
+	return libdns.RR{
+		Name: n.Name,
+		TTL:  n.TTL,
+		Type: "NAPTR",
+		Data: fmt.Sprintf("%d %d %s %s %s %s", n.Order, n.Preference,
+			quoteTXTString(n.Flags), quoteTXTString(n.Service), quoteTXTString(n.Regexp), replacement),
+	}
+}
+
+// Interface guards
+var (
+	_ libdns.Record = SOA{}
+	_ libdns.Record = ALIAS{}
+	_ libdns.Record = DS{}
+	_ libdns.Record = TLSA{}
+	_ libdns.Record = SSHFP{}
+	_ libdns.Record = NAPTR{}
+)
@@ -0,0 +1,248 @@
+package conohav3
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	// defaultRetryBaseDelay is the delay before the first retry; it doubles on each attempt.
+	defaultRetryBaseDelay = 500 * time.Millisecond
+	// defaultRetryMaxDelay caps the delay between two attempts.
+	defaultRetryMaxDelay = 5 * time.Second
+	// defaultMaxRetryWait caps the total time spent waiting between attempts of one request.
+	defaultMaxRetryWait = 30 * time.Second
+)
+
+// retryPolicy controls how doWithRetry attempts and retries a request.
+type retryPolicy struct {
+	maxRetries     int           // retries after the first attempt
+	maxWait        time.Duration // upper bound of the total time spent sleeping between attempts
+	attemptTimeout time.Duration // timeout of each attempt, used only when the context has no deadline
+	baseDelay      time.Duration // backoff delay before the first retry (default: defaultRetryBaseDelay)
+	maxDelay       time.Duration // cap of the backoff delay (default: defaultRetryMaxDelay)
+
+	retryable func(resp *http.Response, err error) bool // failures worth retrying (default: DefaultRetryPolicy)
+
+	limiter *RequestLimiter // bounds the attempts in flight, each holding a slot until its response body is closed (optional)
+}
+
+// doWithRetry sends req and retries it while the failure is transient, as allowed by policy.
+// HTTP 429 responses are retried after the delay given by their Retry-After header.
+// The request body is rewound with req.GetBody before each retry.
+// The deadline of the request context, if any, bounds the whole exchange including retries:
+// no retry is attempted when the backoff delay would not end before it.
+func doWithRetry(client *http.Client, req *http.Request, policy retryPolicy) (*http.Response, error) {
+	var waited time.Duration
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		release, err := policy.limiter.acquire(req.Context())
+		if err != nil {
+			return nil, err
+		}
+		attemptReq, cancelAttempt := withAttemptTimeout(req, policy.attemptTimeout)
+		cancel := func() {
+			cancelAttempt()
+			release()
+		}
+
+		resp, err := client.Do(attemptReq)
+		if attempt >= policy.maxRetries || req.Context().Err() != nil || !policy.isRetryable(resp, err) {
+			if resp != nil {
+				resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+			} else {
+				cancel()
+			}
+			return resp, err
+		}
+
+		delay := policy.retryDelay(attempt)
+		if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				delay = retryAfter
+			}
+		}
+
+		// Give up rather than wait past the overall budget or the caller's deadline,
+		// returning the last failure instead of a context error.
+		if waited+delay > policy.maxWait || exceedsDeadline(req.Context(), delay) {
+			if resp != nil {
+				resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+			} else {
+				cancel()
+			}
+			return resp, err
+		}
+		waited += delay
+
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+		cancel()
+
+		if err := sleepWithContext(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// exceedsDeadline reports whether waiting for d would reach the deadline of ctx, if any.
+func exceedsDeadline(ctx context.Context, d time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return ok && time.Until(deadline) <= d
+}
+
+// withAttemptTimeout bounds req by timeout unless its context already carries a deadline,
+// in which case the caller's deadline takes precedence.
+func withAttemptTimeout(req *http.Request, timeout time.Duration) (*http.Request, context.CancelFunc) {
+	if _, ok := req.Context().Deadline(); ok || timeout <= 0 {
+		return req, func() {}
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	return req.WithContext(ctx), cancel
+}
+
+// cancelOnClose releases the attempt context once the response body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// isRetryable reports whether a request that ended with resp or err is worth retrying.
+func (policy retryPolicy) isRetryable(resp *http.Response, err error) bool {
+	if policy.retryable != nil {
+		return policy.retryable(resp, err)
+	}
+	return DefaultRetryPolicy(resp, err)
+}
+
+// unsent reports whether a request that ended with resp or err certainly wasn't processed:
+// its connection was refused, or it was rejected with HTTP 429.
+func unsent(resp *http.Response, err error) bool {
+	if err != nil {
+		return errors.Is(err, syscall.ECONNREFUSED)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests
+}
+
+// unsentOnly narrows policy for non-idempotent requests, such as record creations, which
+// would be applied twice if retried after reaching the API. Only failures showing that the
+// request wasn't processed are retried: refused connections and HTTP 429 responses.
+func (policy retryPolicy) unsentOnly() retryPolicy {
+	retryable := policy.isRetryable
+	policy.retryable = func(resp *http.Response, err error) bool {
+		return unsent(resp, err) && retryable(resp, err)
+	}
+	return policy
+}
+
+// maybeProcessed reports whether err, returned for a non-idempotent request that
+// unsentOnly didn't retry, is a transient failure that policy would otherwise retry.
+// Such a request may have been applied even though it failed, e.g. on HTTP 502 or a timeout.
+func (policy retryPolicy) maybeProcessed(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		resp := &http.Response{StatusCode: apiErr.StatusCode, Header: http.Header{}, Body: http.NoBody}
+		return !unsent(resp, nil) && policy.isRetryable(resp, nil)
+	}
+	return !unsent(nil, err) && policy.isRetryable(nil, err)
+}
+
+// DefaultRetryPolicy is the retry predicate used when Provider.RetryPolicy is not set.
+// It retries network errors and HTTP 429, 500, 502, 503 and 504 responses.
+// resp is nil when err is set.
+func DefaultRetryPolicy(resp *http.Response, err error) bool {
+	if err != nil {
+		var netErr net.Error
+		return errors.As(err, &netErr)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryDelay returns the exponential backoff delay before the retry following attempt.
+// The delay is randomized between half and all of its value, so that clients
+// failing together don't retry in lockstep.
+func (policy retryPolicy) retryDelay(attempt int) time.Duration {
+	baseDelay, maxDelay := policy.baseDelay, policy.maxDelay
+	if baseDelay <= 0 {
+		baseDelay = defaultRetryBaseDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = defaultRetryMaxDelay
+	}
+
+	delay := baseDelay << attempt
+	if delay <= 0 || delay > maxDelay {
+		delay = maxDelay
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an HTTP-date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	delay := time.Until(date)
+	if delay < 0 {
+		delay = 0
+	}
+	return delay, true
+}
+
+// sleepWithContext waits for d, returning early with the context error if ctx is done.
+func sleepWithContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
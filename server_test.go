@@ -0,0 +1,267 @@
+package conohav3
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConoHa is an in-memory implementation of the subset of the ConoHa Identity and DNS APIs used by Provider.
+type fakeConoHa struct {
+	mu sync.Mutex
+
+	domains  []domain
+	records  map[string][]conohaDNSRecord // keyed by domain UUID
+	nextID   int
+	requests []string // "METHOD path" of every request received
+	token    string   // Token issued and accepted; "fake-token" if empty
+
+	// beforeRequest, if set, is called with each request before it is served, without holding mu.
+	beforeRequest func(r *http.Request)
+}
+
+// newTestProvider returns a Provider whose requests are all served by a fakeConoHa holding a single zone.
+func newTestProvider(t *testing.T, zone string) (*Provider, *fakeConoHa) {
+	t.Helper()
+
+	fake := &fakeConoHa{
+		domains: []domain{{UUID: "domain-id", Name: zone}},
+		records: map[string][]conohaDNSRecord{},
+	}
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Provider{
+		APITenantID: "tenant",
+		APIUserID:   "user",
+		APIPassword: "password",
+		HTTPClient:  &http.Client{Transport: &rewriteTransport{target: target}},
+	}
+
+	return p, fake
+}
+
+// rewriteTransport sends every request to target regardless of the requested host.
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (t *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// addRecord stores rec in the domain identified by domainID and returns it with its UUID.
+func (f *fakeConoHa) addRecord(domainID string, rec conohaDNSRecord) conohaDNSRecord {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.addRecordLocked(domainID, rec)
+}
+
+func (f *fakeConoHa) addRecordLocked(domainID string, rec conohaDNSRecord) conohaDNSRecord {
+	f.nextID++
+	rec.UUID = fmt.Sprintf("record-%d", f.nextID)
+	if rec.TTL == 0 {
+		rec.TTL = 3600
+	}
+	f.records[domainID] = append(f.records[domainID], rec)
+	return rec
+}
+
+// revokeTokens rejects the tokens issued so far, as ConoHa does after a password change.
+func (f *fakeConoHa) revokeTokens(newToken string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.token = newToken
+}
+
+func (f *fakeConoHa) validTokenLocked() string {
+	if f.token == "" {
+		return "fake-token"
+	}
+	return f.token
+}
+
+// countRequests returns how many requests matched the method and path prefix.
+func (f *fakeConoHa) countRequests(method, pathPrefix string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	count := 0
+	for _, r := range f.requests {
+		if strings.HasPrefix(r, method+" "+pathPrefix) {
+			count++
+		}
+	}
+	return count
+}
+
+func (f *fakeConoHa) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.beforeRequest != nil {
+		f.beforeRequest(r)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+
+	if r.URL.Path == "/v3/auth/tokens" && r.Method == http.MethodPost {
+		w.Header().Set("X-Subject-Token", f.validTokenLocked())
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(identityResponse{Token: tokenDetail{IssuedAt: time.Now(), ExpiresAt: time.Now().Add(24 * time.Hour)}})
+		return
+	}
+
+	if r.Header.Get("X-Auth-Token") != f.validTokenLocked() {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) >= 3 && parts[1] == "domains" && !f.hasDomainLocked(parts[2]) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case len(parts) == 2 && parts[1] == "domains" && r.Method == http.MethodGet:
+		_ = json.NewEncoder(w).Encode(domainListResponse{TotalCount: len(f.domains), Domains: f.domains})
+	case len(parts) == 2 && parts[1] == "domains" && r.Method == http.MethodPost:
+		var d domain
+		if err := json.NewDecoder(r.Body).Decode(&d); err != nil || d.Name == "" || d.Email == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.nextID++
+		d.UUID = fmt.Sprintf("domain-%d", f.nextID)
+		f.domains = append(f.domains, d)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(d)
+	case len(parts) == 3 && r.Method == http.MethodPut:
+		var update domainUpdate
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for i, d := range f.domains {
+			if d.UUID == parts[2] {
+				if update.Email != "" {
+					f.domains[i].Email = update.Email
+				}
+				if update.TTL != 0 {
+					f.domains[i].TTL = update.TTL
+				}
+				_ = json.NewEncoder(w).Encode(f.domains[i])
+				break
+			}
+		}
+	case len(parts) == 3 && r.Method == http.MethodDelete:
+		for i, d := range f.domains {
+			if d.UUID == parts[2] {
+				f.domains = append(f.domains[:i:i], f.domains[i+1:]...)
+				delete(f.records, d.UUID)
+				break
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 4 && parts[3] == "records" && r.Method == http.MethodGet:
+		records := f.records[parts[2]]
+		encoded := make([]any, len(records))
+		for i, rec := range records {
+			encoded[i] = recordJSON(rec)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"total_count": len(records), "records": encoded})
+	case len(parts) == 4 && parts[3] == "records" && r.Method == http.MethodPost:
+		var rec conohaDNSRecord
+		if err := json.NewDecoder(r.Body).Decode(&rec); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, old := range f.records[parts[2]] {
+			if old.Name == rec.Name && old.Type == rec.Type && old.Data == rec.Data {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+		}
+		_ = json.NewEncoder(w).Encode(recordJSON(f.addRecordLocked(parts[2], rec)))
+	case len(parts) == 5 && parts[3] == "records":
+		f.serveRecord(w, r, parts[2], parts[4])
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// recordJSON returns rec as encoded in ConoHa responses, including the timestamps that
+// conohaDNSRecord never encodes.
+func recordJSON(rec conohaDNSRecord) any {
+	type plain conohaDNSRecord
+	encoded := struct {
+		plain
+		CreatedAt string `json:"created_at,omitempty"`
+		UpdatedAt string `json:"updated_at,omitempty"`
+	}{plain: plain(rec)}
+	if !rec.CreatedAt.IsZero() {
+		encoded.CreatedAt = rec.CreatedAt.Format(time.RFC3339Nano)
+	}
+	if !rec.UpdatedAt.IsZero() {
+		encoded.UpdatedAt = rec.UpdatedAt.Format(time.RFC3339Nano)
+	}
+	return encoded
+}
+
+func (f *fakeConoHa) hasDomainLocked(domainID string) bool {
+	for _, d := range f.domains {
+		if d.UUID == domainID {
+			return true
+		}
+	}
+	return false
+}
+
+// serveRecord handles PUT and DELETE on a single record.
+func (f *fakeConoHa) serveRecord(w http.ResponseWriter, r *http.Request, domainID, recordID string) {
+	records := f.records[domainID]
+	for i, rec := range records {
+		if rec.UUID != recordID {
+			continue
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			var update conohaDNSRecord
+			if err := json.NewDecoder(r.Body).Decode(&update); err != nil || update.TTL != 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			rec.Name, rec.Type, rec.Data, rec.GSLB, rec.Description = update.Name, update.Type, update.Data, update.GSLB, update.Description
+			rec.UpdatedAt = time.Now().UTC()
+			records[i] = rec
+			_ = json.NewEncoder(w).Encode(recordJSON(rec))
+		case http.MethodDelete:
+			f.records[domainID] = append(records[:i:i], records[i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNotFound)
+}